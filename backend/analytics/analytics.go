@@ -0,0 +1,125 @@
+package analytics
+
+import (
+	"fmt"
+	"time"
+)
+
+// DayLayout is how days are keyed in stored statistics.
+const DayLayout = "2006-01-02"
+
+type Period string
+
+var (
+	PeriodDay  Period = "day"
+	PeriodWeek Period = "week"
+)
+
+func (p Period) IsValid() bool {
+	return p == PeriodDay || p == PeriodWeek
+}
+
+// Metrics are the counters reported for a bucket or a whole range. Likes are
+// net of unlikes, so a bucket may be negative.
+type Metrics struct {
+	Posts        int64 `json:"posts"`
+	Views        int64 `json:"views"`
+	Likes        int64 `json:"likes"`
+	NewFollowers int64 `json:"new_followers"`
+	NewMembers   int64 `json:"new_members"`
+}
+
+func (m *Metrics) Add(other Metrics) {
+	m.Posts += other.Posts
+	m.Views += other.Views
+	m.Likes += other.Likes
+	m.NewFollowers += other.NewFollowers
+	m.NewMembers += other.NewMembers
+}
+
+type Bucket struct {
+	Start string `json:"start"`
+	Metrics
+}
+
+// Series is a run of consecutive buckets covering [From, To] in UTC.
+type Series struct {
+	Period  Period    `json:"period"`
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Buckets []*Bucket `json:"buckets"`
+	Totals  Metrics   `json:"totals"`
+
+	index map[string]*Bucket
+}
+
+// BucketStart truncates t to the start of its day, or of its week for
+// PeriodWeek. Weeks start on Monday.
+func BucketStart(t time.Time, period Period) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if period == PeriodWeek {
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+// ParseRange reads an inclusive from/to pair of days, defaulting to the 30
+// days ending today. Ranges longer than a year are rejected.
+func ParseRange(from string, to string, now time.Time) (time.Time, time.Time, error) {
+	end := BucketStart(now, PeriodDay)
+	if to != "" {
+		t, err := time.Parse(DayLayout, to)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("to must be a YYYY-MM-DD date")
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, -29)
+	if from != "" {
+		t, err := time.Parse(DayLayout, from)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("from must be a YYYY-MM-DD date")
+		}
+		start = t
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	if end.Sub(start) > 366*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("range must be at most a year")
+	}
+	return start, end, nil
+}
+
+func NewSeries(from time.Time, to time.Time, period Period) *Series {
+	s := &Series{
+		Period:  period,
+		From:    from.Format(DayLayout),
+		To:      to.Format(DayLayout),
+		Buckets: []*Bucket{},
+		index:   map[string]*Bucket{},
+	}
+	step := 1
+	if period == PeriodWeek {
+		step = 7
+	}
+	for t := BucketStart(from, period); !t.After(to); t = t.AddDate(0, 0, step) {
+		bucket := &Bucket{Start: t.Format(DayLayout)}
+		s.Buckets = append(s.Buckets, bucket)
+		s.index[bucket.Start] = bucket
+	}
+	return s
+}
+
+// Add counts m in the bucket containing t. Times outside the series are
+// ignored.
+func (s *Series) Add(t time.Time, m Metrics) {
+	bucket, ok := s.index[BucketStart(t, s.Period).Format(DayLayout)]
+	if !ok {
+		return
+	}
+	bucket.Add(m)
+	s.Totals.Add(m)
+}
@@ -0,0 +1,285 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"torospace.csudh.edu/api/entity"
+)
+
+var (
+	ErrUnauthenticated = errors.New("not logged in")
+	ErrForbidden       = errors.New("forbidden")
+)
+
+// Principal is who a request acts as: an account and the persona selected
+// on it, through the cookie session or an access token.
+type Principal struct {
+	AccountID uint
+	// UserID and Role are zero until a persona is selected
+	UserID uint
+	Role   entity.Role
+	// Officer is set when the account may act for the organization persona
+	Officer bool
+	// SuperAdmin is set for the admin persona of a super admin account
+	SuperAdmin bool
+	// Token is set for access tokens, which are limited to Scopes
+	Token  bool
+	Scopes []entity.TokenScope
+	// Impersonation is set while an admin views the site as this principal
+	Impersonation *entity.Impersonation
+}
+
+func (p *Principal) Authenticated() bool {
+	return p != nil && p.AccountID != 0
+}
+
+func (p *Principal) HasScope(scope entity.TokenScope) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+type Action string
+
+const (
+	ReadPost    Action = "post:read"
+	CreatePost  Action = "post:create"
+	EditPost    Action = "post:edit"
+	DeletePost  Action = "post:delete"
+	HidePost    Action = "post:hide"
+	LikePost    Action = "post:like"
+	CreateTopic Action = "topic:create"
+	CreateUser  Action = "user:create"
+	ManageStaff Action = "staff:manage"
+	Impersonate Action = "account:impersonate"
+
+	ViewAdmin             Action = "admin:view"
+	ViewAccount           Action = "account:view"
+	LogoutAccount         Action = "account:logout"
+	ManageCategories      Action = "category:manage"
+	VerifyOrganization    Action = "organization:verify"
+	ManageLoginExceptions Action = "login-exception:manage"
+	ReviewApplications    Action = "application:review"
+
+	CreateAccessToken Action = "token:create"
+
+	EditOrganization      Action = "organization:edit"
+	ViewAnalytics         Action = "organization:analytics"
+	ViewOrganizationAudit Action = "organization:audit"
+	TransferOrganization  Action = "organization:transfer"
+	FederateOrganization  Action = "organization:federate"
+	ManageMembers         Action = "member:manage"
+	AssignMembers         Action = "member:assign"
+	ManageWebhooks        Action = "webhook:manage"
+	InviteCoauthor        Action = "coauthor:invite"
+	AcceptCoauthor        Action = "coauthor:accept"
+	RemoveCoauthor        Action = "coauthor:remove"
+)
+
+// Rule is how a role may perform an action.
+type Rule int
+
+const (
+	Deny Rule = iota
+	// Allow on any resource
+	Allow
+	// AllowOwn on resources the persona owns
+	AllowOwn
+	// AllowShared on resources the persona owns or co-owns
+	AllowShared
+	// AllowSuperAdmin only for super admins
+	AllowSuperAdmin
+	// AllowOfficer on resources the persona owns or of an organization the
+	// account is an owner or officer of, whichever persona it acts as
+	AllowOfficer
+	// AllowOrganizationOwner on resources of an organization the account
+	// is an owner of
+	AllowOrganizationOwner
+)
+
+// Resource is what an action applies to, nil for actions that apply to
+// nothing in particular.
+type Resource struct {
+	OwnerID    uint
+	CoownerIDs []uint
+	// MemberRole is the account's role in the organization the resource
+	// belongs to, empty unless it is an active member
+	MemberRole entity.MemberRole
+}
+
+// PostResource is owned by the post's author and co-owned by its accepted
+// co-authors. Coauthors must be preloaded.
+func PostResource(post *entity.Post) *Resource {
+	res := &Resource{OwnerID: post.AuthorID}
+	for _, coauthor := range post.Coauthors {
+		if coauthor.Status == entity.CoauthorAccepted {
+			res.CoownerIDs = append(res.CoownerIDs, coauthor.OrganizationID)
+		}
+	}
+	return res
+}
+
+// OrganizationResource is owned by the organization. memberRole is the
+// account's active role in it, if any.
+func OrganizationResource(organizationID uint, memberRole entity.MemberRole) *Resource {
+	return &Resource{OwnerID: organizationID, MemberRole: memberRole}
+}
+
+// Public actions need no login. Visibility of the individual resource is
+// still up to the handler.
+var Public = map[Action]bool{
+	ReadPost: true,
+}
+
+// organizationRules are what an account may do for the organizations it
+// runs, whichever of its personas is selected.
+var organizationRules = map[Action]Rule{
+	EditOrganization:      AllowOfficer,
+	ViewAnalytics:         AllowOfficer,
+	ViewOrganizationAudit: AllowOrganizationOwner,
+	TransferOrganization:  AllowOrganizationOwner,
+	FederateOrganization:  AllowOrganizationOwner,
+	ManageMembers:         AllowOfficer,
+	AssignMembers:         AllowOrganizationOwner,
+	ManageWebhooks:        AllowOfficer,
+	AcceptCoauthor:        AllowOfficer,
+	RemoveCoauthor:        AllowOfficer,
+}
+
+func withOrganizationRules(rules map[Action]Rule) map[Action]Rule {
+	for action, rule := range organizationRules {
+		if _, ok := rules[action]; !ok {
+			rules[action] = rule
+		}
+	}
+	return rules
+}
+
+// Matrix is what each persona role may do. Anything missing is denied.
+var Matrix = map[entity.Role]map[Action]Rule{
+	entity.RoleAdmin: {
+		CreatePost:  Allow,
+		EditPost:    Allow,
+		DeletePost:  Allow,
+		HidePost:    Allow,
+		LikePost:    Allow,
+		CreateTopic: Allow,
+		CreateUser:  Allow,
+		ManageStaff: AllowSuperAdmin,
+		Impersonate: Allow,
+
+		CreateAccessToken: Allow,
+
+		ViewAdmin:             Allow,
+		ViewAccount:           Allow,
+		LogoutAccount:         Allow,
+		ManageCategories:      Allow,
+		VerifyOrganization:    Allow,
+		ManageLoginExceptions: Allow,
+		ReviewApplications:    Allow,
+
+		EditOrganization:      Allow,
+		ViewAnalytics:         Allow,
+		ViewOrganizationAudit: Allow,
+		TransferOrganization:  Allow,
+		FederateOrganization:  Allow,
+		ManageMembers:         Allow,
+		AssignMembers:         Allow,
+		ManageWebhooks:        Allow,
+		InviteCoauthor:        Allow,
+		AcceptCoauthor:        Allow,
+		RemoveCoauthor:        Allow,
+	},
+	entity.RoleModerator: withOrganizationRules(map[Action]Rule{
+		HidePost:          Allow,
+		CreateAccessToken: Allow,
+	}),
+	entity.RoleOrganization: withOrganizationRules(map[Action]Rule{
+		CreatePost:     Allow,
+		EditPost:       AllowShared,
+		DeletePost:     AllowOwn,
+		HidePost:       AllowOwn,
+		LikePost:       Allow,
+		InviteCoauthor: AllowOwn,
+
+		CreateAccessToken: Allow,
+	}),
+	entity.RoleStudent: withOrganizationRules(map[Action]Rule{
+		LikePost:          Allow,
+		CreateAccessToken: Allow,
+	}),
+}
+
+// TokenScopes is the scope an access token needs for an action. Actions
+// missing here cannot be performed with a token at all.
+var TokenScopes = map[Action]entity.TokenScope{
+	ReadPost:   entity.ScopePostsRead,
+	CreatePost: entity.ScopePostsWrite,
+	EditPost:   entity.ScopePostsWrite,
+	LikePost:   entity.ScopeLikes,
+}
+
+// Permits reports whether p could perform action on some resource, before
+// the resource is loaded.
+func Permits(p *Principal, action Action) error {
+	if p.Authenticated() && p.Token {
+		scope, ok := TokenScopes[action]
+		if !ok || !p.HasScope(scope) {
+			return fmt.Errorf("%w: access token may not %s", ErrForbidden, action)
+		}
+	}
+	if Public[action] {
+		return nil
+	}
+	if !p.Authenticated() {
+		return ErrUnauthenticated
+	}
+	if p.UserID == 0 {
+		return fmt.Errorf("%w: no persona selected", ErrForbidden)
+	}
+	// Organizations only act through their officers
+	if p.Role == entity.RoleOrganization && !p.Officer {
+		return fmt.Errorf("%w: account %d is not an officer of %d", ErrForbidden, p.AccountID, p.UserID)
+	}
+	switch Matrix[p.Role][action] {
+	case Deny:
+		return fmt.Errorf("%w: %s may not %s", ErrForbidden, p.Role, action)
+	case AllowSuperAdmin:
+		if !p.SuperAdmin {
+			return fmt.Errorf("%w: account %d is not a super admin", ErrForbidden, p.AccountID)
+		}
+	}
+	return nil
+}
+
+// Decide returns nil when p may perform action on res, or why not.
+func Decide(p *Principal, action Action, res *Resource) error {
+	if err := Permits(p, action); err != nil {
+		return err
+	}
+	if Public[action] {
+		return nil
+	}
+
+	switch Matrix[p.Role][action] {
+	case Allow, AllowSuperAdmin:
+		return nil
+	case AllowOwn:
+		if res != nil && res.OwnerID == p.UserID {
+			return nil
+		}
+	case AllowShared:
+		if res != nil && (res.OwnerID == p.UserID || slices.Contains(res.CoownerIDs, p.UserID)) {
+			return nil
+		}
+	case AllowOfficer:
+		if res != nil && (res.OwnerID == p.UserID || res.MemberRole.CanActAsOrganization()) {
+			return nil
+		}
+	case AllowOrganizationOwner:
+		if res != nil && res.MemberRole == entity.MemberRoleOwner {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: user %d does not own the resource of %s", ErrForbidden, p.UserID, action)
+}
@@ -0,0 +1,209 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+
+	"torospace.csudh.edu/api/entity"
+)
+
+const (
+	accountID    = 1
+	studentID    = 2
+	organization = 10
+	otherOrg     = 11
+	coauthorOrg  = 12
+)
+
+func student() *Principal {
+	return &Principal{AccountID: accountID, UserID: studentID, Role: entity.RoleStudent}
+}
+
+func officer(organizationID uint) *Principal {
+	return &Principal{AccountID: accountID, UserID: organizationID, Role: entity.RoleOrganization, Officer: true}
+}
+
+func moderator() *Principal {
+	return &Principal{AccountID: accountID, UserID: 3, Role: entity.RoleModerator}
+}
+
+func admin(superAdmin bool) *Principal {
+	return &Principal{AccountID: accountID, UserID: 4, Role: entity.RoleAdmin, SuperAdmin: superAdmin}
+}
+
+func token(p *Principal, scopes ...entity.TokenScope) *Principal {
+	p.Token = true
+	p.Scopes = scopes
+	return p
+}
+
+func impersonated(p *Principal, allowWrites bool) *Principal {
+	p.Impersonation = &entity.Impersonation{AdminAccountID: 99, AllowWrites: allowWrites}
+	return p
+}
+
+func post(authorID uint, coownerIDs ...uint) *Resource {
+	return &Resource{OwnerID: authorID, CoownerIDs: coownerIDs}
+}
+
+func coauthorLink(authorID uint, memberRole entity.MemberRole) *Resource {
+	return &Resource{OwnerID: authorID, MemberRole: memberRole}
+}
+
+type decision struct {
+	name    string
+	p       *Principal
+	action  Action
+	res     *Resource
+	permits error
+	decide  error
+}
+
+func checkDecisions(t *testing.T, decisions []decision) {
+	t.Helper()
+	for _, d := range decisions {
+		t.Run(d.name, func(t *testing.T) {
+			if err := Permits(d.p, d.action); !matches(err, d.permits) {
+				t.Errorf("Permits(%s) = %v, want %v", d.action, err, d.permits)
+			}
+			if err := Decide(d.p, d.action, d.res); !matches(err, d.decide) {
+				t.Errorf("Decide(%s) = %v, want %v", d.action, err, d.decide)
+			}
+		})
+	}
+}
+
+func matches(err error, want error) bool {
+	if want == nil {
+		return err == nil
+	}
+	return errors.Is(err, want)
+}
+
+func TestPosts(t *testing.T) {
+	checkDecisions(t, []decision{
+		{"anonymous reads", &Principal{}, ReadPost, nil, nil, nil},
+		{"anonymous likes", &Principal{}, LikePost, nil, ErrUnauthenticated, ErrUnauthenticated},
+		{"no persona likes", &Principal{AccountID: accountID}, LikePost, nil, ErrForbidden, ErrForbidden},
+		{"student likes", student(), LikePost, nil, nil, nil},
+		{"student creates", student(), CreatePost, nil, ErrForbidden, ErrForbidden},
+		{"student hides", student(), HidePost, post(organization), ErrForbidden, ErrForbidden},
+
+		{"officer creates", officer(organization), CreatePost, nil, nil, nil},
+		{"non-officer creates", &Principal{AccountID: accountID, UserID: organization, Role: entity.RoleOrganization}, CreatePost, nil, ErrForbidden, ErrForbidden},
+		{"officer deletes own", officer(organization), DeletePost, post(organization), nil, nil},
+		{"officer deletes other's", officer(organization), DeletePost, post(otherOrg), nil, ErrForbidden},
+		{"officer deletes nothing", officer(organization), DeletePost, nil, nil, ErrForbidden},
+		{"officer deletes co-authored", officer(organization), DeletePost, post(otherOrg, organization), nil, ErrForbidden},
+		{"officer edits co-authored", officer(organization), EditPost, post(otherOrg, organization), nil, nil},
+		{"officer edits other's", officer(organization), EditPost, post(otherOrg, coauthorOrg), nil, ErrForbidden},
+		{"officer hides own", officer(organization), HidePost, post(organization), nil, nil},
+		{"officer hides other's", officer(organization), HidePost, post(otherOrg), nil, ErrForbidden},
+
+		{"moderator hides any", moderator(), HidePost, post(otherOrg), nil, nil},
+		{"moderator deletes", moderator(), DeletePost, post(otherOrg), ErrForbidden, ErrForbidden},
+		{"admin deletes any", admin(false), DeletePost, post(otherOrg), nil, nil},
+		{"admin edits any", admin(false), EditPost, post(otherOrg), nil, nil},
+	})
+}
+
+func TestStaff(t *testing.T) {
+	decisions := []decision{
+		{"admin manages staff", admin(false), ManageStaff, nil, ErrForbidden, ErrForbidden},
+		{"super admin manages staff", admin(true), ManageStaff, nil, nil, nil},
+		{"admin creates topic", admin(false), CreateTopic, nil, nil, nil},
+		{"moderator creates topic", moderator(), CreateTopic, nil, ErrForbidden, ErrForbidden},
+		{"admin impersonates", admin(false), Impersonate, nil, nil, nil},
+	}
+	adminOnly := []Action{
+		CreateUser, ViewAdmin, ViewAccount, LogoutAccount, ManageCategories,
+		VerifyOrganization, ManageLoginExceptions, ReviewApplications,
+	}
+	for _, action := range adminOnly {
+		decisions = append(decisions,
+			decision{"admin " + string(action), admin(false), action, nil, nil, nil},
+			decision{"moderator " + string(action), moderator(), action, nil, ErrForbidden, ErrForbidden},
+			decision{"officer " + string(action), officer(organization), action, nil, ErrForbidden, ErrForbidden},
+			decision{"student " + string(action), student(), action, nil, ErrForbidden, ErrForbidden},
+		)
+	}
+	checkDecisions(t, decisions)
+}
+
+func TestOrganizations(t *testing.T) {
+	officerActions := []Action{EditOrganization, ViewAnalytics, ManageMembers, ManageWebhooks, AcceptCoauthor}
+	ownerActions := []Action{ViewOrganizationAudit, TransferOrganization, FederateOrganization, AssignMembers}
+
+	var decisions []decision
+	for _, action := range officerActions {
+		name := string(action)
+		decisions = append(decisions,
+			decision{"owner " + name, student(), action, OrganizationResource(organization, entity.MemberRoleOwner), nil, nil},
+			decision{"officer " + name, student(), action, OrganizationResource(organization, entity.MemberRoleOfficer), nil, nil},
+			decision{"member " + name, student(), action, OrganizationResource(organization, entity.MemberRoleMember), nil, ErrForbidden},
+			decision{"outsider " + name, student(), action, OrganizationResource(organization, ""), nil, ErrForbidden},
+			decision{"persona " + name, officer(organization), action, OrganizationResource(organization, entity.MemberRoleOfficer), nil, nil},
+			decision{"other persona " + name, officer(otherOrg), action, OrganizationResource(organization, ""), nil, ErrForbidden},
+			decision{"admin " + name, admin(false), action, OrganizationResource(organization, ""), nil, nil},
+			decision{"token " + name, token(student(), entity.ScopePostsRead, entity.ScopePostsWrite, entity.ScopeLikes), action, OrganizationResource(organization, entity.MemberRoleOwner), ErrForbidden, ErrForbidden},
+		)
+	}
+	for _, action := range ownerActions {
+		name := string(action)
+		decisions = append(decisions,
+			decision{"owner " + name, student(), action, OrganizationResource(organization, entity.MemberRoleOwner), nil, nil},
+			decision{"officer " + name, student(), action, OrganizationResource(organization, entity.MemberRoleOfficer), nil, ErrForbidden},
+			decision{"officer persona " + name, officer(organization), action, OrganizationResource(organization, entity.MemberRoleOfficer), nil, ErrForbidden},
+			decision{"owner persona " + name, officer(organization), action, OrganizationResource(organization, entity.MemberRoleOwner), nil, nil},
+			decision{"admin " + name, admin(false), action, OrganizationResource(organization, ""), nil, nil},
+		)
+	}
+	checkDecisions(t, decisions)
+}
+
+func TestCoauthors(t *testing.T) {
+	checkDecisions(t, []decision{
+		{"author invites", officer(organization), InviteCoauthor, post(organization), nil, nil},
+		{"co-author invites", officer(organization), InviteCoauthor, post(otherOrg, organization), nil, ErrForbidden},
+		{"student invites", student(), InviteCoauthor, post(organization), ErrForbidden, ErrForbidden},
+		{"admin invites", admin(false), InviteCoauthor, post(otherOrg), nil, nil},
+
+		{"author removes", officer(organization), RemoveCoauthor, coauthorLink(organization, ""), nil, nil},
+		{"co-author officer removes", student(), RemoveCoauthor, coauthorLink(otherOrg, entity.MemberRoleOfficer), nil, nil},
+		{"co-author member removes", student(), RemoveCoauthor, coauthorLink(otherOrg, entity.MemberRoleMember), nil, ErrForbidden},
+		{"stranger removes", officer(organization), RemoveCoauthor, coauthorLink(otherOrg, ""), nil, ErrForbidden},
+		{"admin removes", admin(false), RemoveCoauthor, coauthorLink(otherOrg, ""), nil, nil},
+	})
+}
+
+func TestTokens(t *testing.T) {
+	checkDecisions(t, []decision{
+		{"reads with scope", token(student(), entity.ScopePostsRead), ReadPost, nil, nil, nil},
+		{"reads without scope", token(student(), entity.ScopeLikes), ReadPost, nil, ErrForbidden, ErrForbidden},
+		{"likes with scope", token(student(), entity.ScopeLikes), LikePost, nil, nil, nil},
+		{"likes without scope", token(student(), entity.ScopePostsRead), LikePost, nil, ErrForbidden, ErrForbidden},
+		{"creates with scope", token(officer(organization), entity.ScopePostsWrite), CreatePost, nil, nil, nil},
+		{"edits own with scope", token(officer(organization), entity.ScopePostsWrite), EditPost, post(organization), nil, nil},
+		{"edits other's with scope", token(officer(organization), entity.ScopePostsWrite), EditPost, post(otherOrg), nil, ErrForbidden},
+		{"scope beyond role", token(student(), entity.ScopePostsWrite), CreatePost, nil, ErrForbidden, ErrForbidden},
+		{"deletes with write scope", token(officer(organization), entity.ScopePostsWrite), DeletePost, post(organization), ErrForbidden, ErrForbidden},
+		{"admin token", token(admin(true), entity.ScopePostsRead, entity.ScopePostsWrite, entity.ScopeLikes), ManageStaff, nil, ErrForbidden, ErrForbidden},
+		{"student creates token", student(), CreateAccessToken, nil, nil, nil},
+		{"officer creates token", officer(organization), CreateAccessToken, nil, nil, nil},
+		{"token creates token", token(student(), entity.ScopePostsRead, entity.ScopePostsWrite, entity.ScopeLikes), CreateAccessToken, nil, ErrForbidden, ErrForbidden},
+		{"no persona creates token", &Principal{AccountID: accountID}, CreateAccessToken, nil, ErrForbidden, ErrForbidden},
+	})
+}
+
+func TestImpersonation(t *testing.T) {
+	// An impersonated principal decides as the persona it views the site as
+	checkDecisions(t, []decision{
+		{"reads", impersonated(student(), false), ReadPost, nil, nil, nil},
+		{"likes", impersonated(student(), false), LikePost, nil, nil, nil},
+		{"creates as student", impersonated(student(), true), CreatePost, nil, ErrForbidden, ErrForbidden},
+		{"deletes own", impersonated(officer(organization), true), DeletePost, post(organization), nil, nil},
+		{"deletes other's", impersonated(officer(organization), true), DeletePost, post(otherOrg), nil, ErrForbidden},
+		{"manages as officer", impersonated(student(), true), ManageWebhooks, OrganizationResource(organization, entity.MemberRoleOfficer), nil, nil},
+		{"manages as outsider", impersonated(student(), true), ManageWebhooks, OrganizationResource(organization, ""), nil, ErrForbidden},
+	})
+}
@@ -0,0 +1,126 @@
+// Command apstub is a minimal remote ActivityPub server for local testing.
+// It serves a single actor, logs every activity delivered to its inbox after
+// verifying the HTTP signature, and can send a Follow to a Toro Space actor:
+//
+//	go run ./cmd/apstub -follow http://localhost:3030/ap/users/1
+//
+// Run the API with ACTIVITYPUB_ALLOW_HTTP=true so it will talk to the stub, and
+// opt the organization in with PUT /organizations/:organizationID/federation.
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"torospace.csudh.edu/api/gateway/activitypub"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8090", "address to serve the stub actor on")
+	follow := flag.String("follow", "", "actor URL to send a Follow to")
+	flag.Parse()
+
+	publicPem, privatePem, err := activitypub.GenerateKeyPair()
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, err := activitypub.ParsePrivateKey(privatePem)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	base := "http://" + *addr
+	actor := activitypub.Actor{
+		Context:           activitypub.Context,
+		ID:                base + "/actor",
+		Type:              "Person",
+		PreferredUsername: "stub",
+		Name:              "Stub Inbox",
+		Inbox:             base + "/inbox",
+		Outbox:            base + "/outbox",
+		PublicKey: activitypub.PublicKey{
+			ID:           base + "/actor#main-key",
+			Owner:        base + "/actor",
+			PublicKeyPem: publicPem,
+		},
+	}
+	gateway := activitypub.New(true)
+
+	http.HandleFunc("/actor", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", activitypub.ContentType)
+		json.NewEncoder(w).Encode(actor)
+	})
+	http.HandleFunc("/inbox", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var verified string
+		sig, err := activitypub.ParseSignature(r.Header.Get("Signature"))
+		if err == nil {
+			var signer *activitypub.Actor
+			signer, err = gateway.FetchActor(r.Context(), sig.KeyID)
+			if err == nil {
+				publicKey, keyErr := activitypub.ParsePublicKey(signer.PublicKey.PublicKeyPem)
+				err = keyErr
+				if err == nil {
+					getHeader := func(name string) string {
+						if name == "host" {
+							return r.Host
+						}
+						return r.Header.Get(name)
+					}
+					err = activitypub.VerifyRequest(sig, r.Method, r.URL.RequestURI(), body, getHeader, publicKey)
+				}
+			}
+		}
+		if err == nil {
+			verified = "verified"
+		} else {
+			verified = fmt.Sprintf("signature error: %s", err)
+		}
+
+		activity := &activitypub.Activity{}
+		json.Unmarshal(body, activity)
+		log.Printf("inbox (%s): %s from %s\n%s", verified, activity.Type, activity.Actor, body)
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	if *follow != "" {
+		go func() {
+			time.Sleep(500 * time.Millisecond)
+			if err := sendFollow(gateway, &actor, key, *follow); err != nil {
+				log.Printf("Follow failed: %s", err)
+			}
+		}()
+	}
+
+	log.Printf("Stub actor at %s/actor", base)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func sendFollow(gateway activitypub.ActivityPubGateway, actor *activitypub.Actor, key *rsa.PrivateKey, target string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	remote, err := gateway.FetchActor(ctx, target)
+	if err != nil {
+		return err
+	}
+	follow, err := activitypub.NewActivity(actor.ID+"#follow", "Follow", actor.ID, remote.ID)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(follow)
+	if err != nil {
+		return err
+	}
+	status, err := gateway.Deliver(ctx, remote.Inbox, body, actor.PublicKey.ID, key)
+	log.Printf("Sent Follow to %s: %d", remote.Inbox, status)
+	return err
+}
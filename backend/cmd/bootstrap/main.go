@@ -0,0 +1,72 @@
+// Command bootstrap makes the first super admin, who can then promote other
+// staff through the API. Run it in the directory holding torospace.db:
+//
+//	go run ../cmd/bootstrap -email you@csudh.edu
+//
+// The account is created when the person has not logged in yet, and is
+// linked to their identity on their first Google login by its verified
+// email.
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/sqlite"
+)
+
+func main() {
+	email := flag.String("email", "", "email of the account to make super admin")
+	force := flag.Bool("force", false, "grant even when a super admin already exists")
+	flag.Parse()
+	// ADMIN_EMAIL in .env decides who the upgrade backfill makes super admin
+	godotenv.Load()
+
+	addr := strings.ToLower(strings.TrimSpace(*email))
+	if !strings.Contains(addr, "@") {
+		log.Fatal("-email is required")
+	}
+
+	db, err := sqlite.NewDB()
+	if err != nil {
+		log.Fatalf("Unable to connect to database: %s", err)
+	}
+
+	exists, err := db.HasSuperAdmin()
+	if err != nil {
+		log.Fatalf("Failed to check for a super admin: %s", err)
+	}
+	if exists && !*force {
+		log.Fatal("A super admin already exists; promote staff through the API or pass -force")
+	}
+
+	account, err := db.GetAccountByEmail(addr)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		account = &entity.Account{
+			Email: addr,
+			Users: []entity.User{
+				{
+					DisplayName: strings.Split(addr, "@")[0],
+					Role:        entity.RoleStudent,
+				},
+			},
+		}
+		if err := db.AddAccount(account); err != nil {
+			log.Fatalf("Failed to create account for %s: %s", addr, err)
+		}
+		log.Printf("Created account %d for %s", account.ID, addr)
+	} else if err != nil {
+		log.Fatalf("Failed to get account for %s: %s", addr, err)
+	}
+
+	grant, err := db.SetStaffRole(account, entity.StaffSuperAdmin, nil, nil)
+	if err != nil {
+		log.Fatalf("Failed to grant super admin to %s: %s", addr, err)
+	}
+	log.Printf("%s is now a super admin acting as user %d", addr, grant.UserID)
+}
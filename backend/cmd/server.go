@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/healthcheck"
+	"torospace.csudh.edu/api/handler"
 	"torospace.csudh.edu/api/router"
 )
 
@@ -18,6 +20,14 @@ func main() {
 	// Add routes
 	router.SetupRoutes(app)
 
+	// Background jobs
+	handler.StartDigestJob(context.Background())
+	handler.StartWebhookJob(context.Background())
+	handler.StartActivityPubJob(context.Background())
+	handler.StartViewJob(context.Background())
+	handler.StartSessionCleanupJob(context.Background())
+	handler.StartAccountDeletionJob(context.Background())
+
 	if err := app.Listen(":3030"); err != nil {
 		log.Fatal(err)
 	}
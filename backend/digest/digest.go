@@ -0,0 +1,56 @@
+package digest
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+	"time"
+
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/gateway/mail"
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/digest.html"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templates, "templates/digest.txt"))
+)
+
+// Digest is everything needed to render one account's weekly email.
+type Digest struct {
+	Account        *entity.Account
+	Posts          []*entity.Post
+	Since          time.Time
+	SiteURL        string
+	UnsubscribeURL string
+}
+
+func (d *Digest) Subject() string {
+	return "Your week on Toro Space"
+}
+
+// Build renders the digest into a message ready for a mail.Transport.
+func Build(d *Digest) (*mail.Message, error) {
+	var html bytes.Buffer
+	if err := htmlTemplate.Execute(&html, d); err != nil {
+		return nil, err
+	}
+	var text bytes.Buffer
+	if err := textTemplate.Execute(&text, d); err != nil {
+		return nil, err
+	}
+
+	return &mail.Message{
+		To:      d.Account.Email,
+		Subject: d.Subject(),
+		HTML:    html.String(),
+		Text:    text.String(),
+		Headers: map[string]string{
+			"List-Unsubscribe":      "<" + d.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	}, nil
+}
@@ -1,11 +1,25 @@
 package entity
 
+import "time"
+
 type Account struct {
 	ID        uint   `json:"id" gorm:"primaryKey;autoIncrement"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Email     string `json:"email"`
-	GoogleID  string `json:"google_id"`
 
 	Users []User `json:"users" gorm:"many2many:account_users"`
 }
+
+// AccountIdentity links an account to a login at an identity provider. An
+// account may have several, e.g. Google and the campus SSO.
+type AccountIdentity struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	AccountID uint   `json:"account_id" gorm:"index"`
+	Provider  string `json:"provider" gorm:"uniqueIndex:idx_identity_subject"`
+	Subject   string `json:"-" gorm:"uniqueIndex:idx_identity_subject"`
+	Email     string `json:"email"`
+
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
@@ -0,0 +1,48 @@
+package entity
+
+import "time"
+
+// ActivityPubActor holds the federation identity of an organization user.
+type ActivityPubActor struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	UserID        uint   `json:"user_id" gorm:"uniqueIndex"`
+	User          User   `json:"-" gorm:"foreignKey:UserID"`
+	Handle        string `json:"handle" gorm:"uniqueIndex"`
+	PublicKeyPem  string `json:"-"`
+	PrivateKeyPem string `json:"-"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+type ActivityPubFollower struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	UserID   uint   `json:"user_id" gorm:"uniqueIndex:idx_follower_user_actor"`
+	ActorURI string `json:"actor_uri" gorm:"uniqueIndex:idx_follower_user_actor"`
+	InboxURL string `json:"inbox_url"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+type ActivityPubDeliveryStatus string
+
+var (
+	ActivityPubDeliveryPending   ActivityPubDeliveryStatus = "pending"
+	ActivityPubDeliverySucceeded ActivityPubDeliveryStatus = "succeeded"
+	ActivityPubDeliveryFailed    ActivityPubDeliveryStatus = "failed"
+)
+
+type ActivityPubDelivery struct {
+	ID       uint                      `json:"id" gorm:"primaryKey"`
+	UserID   uint                      `json:"user_id" gorm:"index"`
+	InboxURL string                    `json:"inbox_url"`
+	Activity string                    `json:"activity"`
+	Status   ActivityPubDeliveryStatus `json:"status" gorm:"index"`
+
+	Attempts       int       `json:"attempts"`
+	NextAttemptAt  time.Time `json:"next_attempt_at" gorm:"index"`
+	LastStatusCode int       `json:"last_status_code"`
+	LastError      string    `json:"last_error"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
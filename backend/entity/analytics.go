@@ -0,0 +1,20 @@
+package entity
+
+// PostStat holds one day of engagement for a post. Rows are incremented as
+// views and likes happen, so dashboards never scan raw events.
+type PostStat struct {
+	PostID   uint   `json:"post_id" gorm:"primaryKey;autoIncrement:false"`
+	Day      string `json:"day" gorm:"primaryKey"`
+	AuthorID uint   `json:"author_id" gorm:"index"`
+	Views    int64  `json:"views"`
+	// Likes is net of unlikes made the same day.
+	Likes int64 `json:"likes"`
+}
+
+// TopicStat summarizes an organization's posts under one topic.
+type TopicStat struct {
+	Name  string `json:"name"`
+	Posts int64  `json:"posts"`
+	Views int64  `json:"views"`
+	Likes int64  `json:"likes"`
+}
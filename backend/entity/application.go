@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"fmt"
+	"net/mail"
+	"time"
+	"unicode/utf8"
+)
+
+type ApplicationStatus string
+
+var (
+	ApplicationPending  ApplicationStatus = "pending"
+	ApplicationApproved ApplicationStatus = "approved"
+	ApplicationRejected ApplicationStatus = "rejected"
+)
+
+// OrganizationApplication is a student's request to register a new
+// organization. Approving it creates the organization user on their account.
+type OrganizationApplication struct {
+	ID           uint              `json:"id" gorm:"primaryKey"`
+	AccountID    uint              `json:"account_id" gorm:"index"`
+	Account      Account           `json:"-" gorm:"foreignKey:AccountID"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description"`
+	AdvisorName  string            `json:"advisor_name"`
+	AdvisorEmail string            `json:"advisor_email"`
+	Status       ApplicationStatus `json:"status" gorm:"index"`
+
+	ReviewedByAccountID uint       `json:"reviewed_by_account_id"`
+	ReviewedAt          *time.Time `json:"reviewed_at"`
+	OrganizationID      uint       `json:"organization_id"`
+
+	Comments []ApplicationComment `json:"comments" gorm:"foreignKey:ApplicationID"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+type ApplicationComment struct {
+	ID            uint   `json:"id" gorm:"primaryKey"`
+	ApplicationID uint   `json:"application_id" gorm:"index"`
+	AccountID     uint   `json:"account_id"`
+	Body          string `json:"body"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (a *OrganizationApplication) Validate() error {
+	if length := utf8.RuneCountInString(a.Name); length < 3 || length > 100 {
+		return fmt.Errorf("name must be between 3 and 100 characters")
+	}
+	if utf8.RuneCountInString(a.Description) > 2000 {
+		return fmt.Errorf("description must be at most 2000 characters")
+	}
+	if a.AdvisorName == "" {
+		return fmt.Errorf("advisor_name is required")
+	}
+	address, err := mail.ParseAddress(a.AdvisorEmail)
+	if err != nil || address.Address != a.AdvisorEmail {
+		return fmt.Errorf("advisor_email must be a plain email address")
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+// AuditEntry records a sensitive change for later review. Subject identifies
+// what was changed, e.g. SubjectType "organization" with the organization ID.
+type AuditEntry struct {
+	ID             uint              `json:"id" gorm:"primaryKey"`
+	ActorAccountID uint              `json:"actor_account_id" gorm:"index"`
+	Action         string            `json:"action"`
+	SubjectType    string            `json:"subject_type" gorm:"index:idx_audit_subject"`
+	SubjectID      uint              `json:"subject_id" gorm:"index:idx_audit_subject"`
+	Details        map[string]string `json:"details" gorm:"serializer:json"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Category is an admin-managed directory category. Organization profiles
+// reference it by Slug.
+type Category struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Slug string `json:"slug" gorm:"uniqueIndex"`
+	Name string `json:"name"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// DefaultCategories are created the first time the database is opened.
+var DefaultCategories = []Category{
+	{Slug: "academic", Name: "Academic"},
+	{Slug: "cultural", Name: "Cultural"},
+	{Slug: "sports", Name: "Sports"},
+	{Slug: "arts", Name: "Arts"},
+	{Slug: "service", Name: "Service"},
+	{Slug: "professional", Name: "Professional"},
+	{Slug: "social", Name: "Social"},
+}
+
+var categorySlugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+func (c *Category) Validate() error {
+	if !categorySlugPattern.MatchString(c.Slug) {
+		return fmt.Errorf("slug must be lowercase letters and digits separated by dashes")
+	}
+	if err := validateLength("slug", c.Slug, 50); err != nil {
+		return err
+	}
+	if c.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	return validateLength("name", c.Name, 50)
+}
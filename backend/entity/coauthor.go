@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+type CoauthorStatus string
+
+var (
+	CoauthorInvited  CoauthorStatus = "invited"
+	CoauthorAccepted CoauthorStatus = "accepted"
+)
+
+// PostCoauthor is an organization invited to co-author a post. Once
+// accepted, the post is listed under the organization and its officers may
+// edit it.
+type PostCoauthor struct {
+	ID                 uint           `json:"-" gorm:"primaryKey"`
+	PostID             uint           `json:"post_id" gorm:"uniqueIndex:idx_coauthor_post_organization"`
+	Post               *Post          `json:"post,omitempty" gorm:"foreignKey:PostID"`
+	OrganizationID     uint           `json:"organization_id" gorm:"uniqueIndex:idx_coauthor_post_organization;index"`
+	Organization       User           `json:"organization" gorm:"foreignKey:OrganizationID"`
+	Status             CoauthorStatus `json:"status"`
+	InvitedByAccountID uint           `json:"-"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// AccountDeletion is a pending request to delete an account. The account
+// keeps working and the request can be cancelled until ScheduledFor.
+type AccountDeletion struct {
+	AccountID    uint      `json:"account_id" gorm:"primaryKey;autoIncrement:false"`
+	RequestedAt  time.Time `json:"requested_at" gorm:"autoCreateTime"`
+	ScheduledFor time.Time `json:"scheduled_for" gorm:"index"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+type DigestSubscription struct {
+	ID            uint    `json:"id" gorm:"primaryKey"`
+	AccountID     uint    `json:"account_id" gorm:"uniqueIndex"`
+	Enabled       bool    `json:"enabled"`
+	Organizations []User  `json:"organizations" gorm:"many2many:digest_organizations"`
+	Topics        []Topic `json:"topics" gorm:"many2many:digest_topics"`
+
+	UnsubscribeToken string     `json:"-" gorm:"uniqueIndex"`
+	LastSentAt       *time.Time `json:"last_sent_at"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// LoginException lets an email outside the allowed campus domains log in,
+// e.g. a guest speaker or an off-campus advisor.
+type LoginException struct {
+	ID               uint   `json:"id" gorm:"primaryKey"`
+	Email            string `json:"email" gorm:"uniqueIndex"`
+	Reason           string `json:"reason"`
+	AddedByAccountID uint   `json:"added_by_account_id"`
+
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// IsActive reports whether the exception still applies at t.
+func (e *LoginException) IsActive(t time.Time) bool {
+	return e.ExpiresAt == nil || t.Before(*e.ExpiresAt)
+}
@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// Impersonation is an admin viewing the site as another account and
+// persona. Requests made during it are audited against its ID.
+type Impersonation struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	AdminAccountID uint   `json:"admin_account_id" gorm:"index"`
+	AdminUserID    uint   `json:"admin_user_id"`
+	AccountID      uint   `json:"account_id" gorm:"index"`
+	UserID         uint   `json:"user_id"`
+	Reason         string `json:"reason"`
+	// AllowWrites lifts the default block on requests that change anything
+	AllowWrites bool `json:"allow_writes"`
+
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+}
+
+func (i *Impersonation) IsActive(now time.Time) bool {
+	return i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
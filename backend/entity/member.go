@@ -0,0 +1,44 @@
+package entity
+
+import "time"
+
+type MemberRole string
+
+var (
+	MemberRoleOwner   MemberRole = "owner"
+	MemberRoleOfficer MemberRole = "officer"
+	MemberRoleMember  MemberRole = "member"
+)
+
+type MemberStatus string
+
+var (
+	MemberStatusInvited MemberStatus = "invited"
+	MemberStatusActive  MemberStatus = "active"
+	// MemberStatusRequested is a join request awaiting officer approval.
+	MemberStatusRequested MemberStatus = "requested"
+)
+
+// OrganizationMember links an account to an organization user. Owners and
+// officers of an active membership may act as the organization persona.
+type OrganizationMember struct {
+	ID                 uint         `json:"id" gorm:"primaryKey"`
+	OrganizationID     uint         `json:"organization_id" gorm:"uniqueIndex:idx_member_organization_account"`
+	AccountID          uint         `json:"account_id" gorm:"uniqueIndex:idx_member_organization_account"`
+	Account            Account      `json:"-" gorm:"foreignKey:AccountID"`
+	Role               MemberRole   `json:"role"`
+	Status             MemberStatus `json:"status"`
+	InvitedByAccountID uint         `json:"invited_by_account_id"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func (r MemberRole) IsValid() bool {
+	return r == MemberRoleOwner || r == MemberRoleOfficer || r == MemberRoleMember
+}
+
+// CanActAsOrganization reports whether the role grants use of the persona.
+func (r MemberRole) CanActAsOrganization() bool {
+	return r == MemberRoleOwner || r == MemberRoleOfficer
+}
@@ -0,0 +1,110 @@
+package entity
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"time"
+	"unicode/utf8"
+)
+
+type SocialLink struct {
+	Platform string `json:"platform"`
+	URL      string `json:"url"`
+}
+
+// JoinPolicy controls how students become members of an organization.
+type JoinPolicy string
+
+var (
+	JoinPolicyOpen       JoinPolicy = "open"
+	JoinPolicyApproval   JoinPolicy = "approval"
+	JoinPolicyInviteOnly JoinPolicy = "invite_only"
+)
+
+type OrganizationProfile struct {
+	ID              uint         `json:"-" gorm:"primaryKey"`
+	UserID          uint         `json:"-" gorm:"uniqueIndex"`
+	Description     string       `json:"description"`
+	Category        string       `json:"category"`
+	MeetingSchedule string       `json:"meeting_schedule"`
+	ContactEmail    string       `json:"contact_email"`
+	SocialLinks     []SocialLink `json:"social_links" gorm:"serializer:json"`
+	BannerUrl       string       `json:"banner_url"`
+	JoinPolicy      JoinPolicy   `json:"join_policy" gorm:"default:approval"`
+
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+func validateLength(field string, value string, max int) error {
+	if utf8.RuneCountInString(value) > max {
+		return fmt.Errorf("%s must be at most %d characters", field, max)
+	}
+	return nil
+}
+
+func validateURL(field string, value string) error {
+	if value == "" {
+		return nil
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an http or https URL", field)
+	}
+	return validateLength(field, value, 500)
+}
+
+func (j JoinPolicy) IsValid() bool {
+	return j == JoinPolicyOpen || j == JoinPolicyApproval || j == JoinPolicyInviteOnly
+}
+
+// EffectiveJoinPolicy is the profile's join policy, defaulting to approval
+// for organizations without a profile.
+func (p *OrganizationProfile) EffectiveJoinPolicy() JoinPolicy {
+	if p == nil || p.JoinPolicy == "" {
+		return JoinPolicyApproval
+	}
+	return p.JoinPolicy
+}
+
+func (p *OrganizationProfile) Validate() error {
+	if err := validateLength("description", p.Description, 2000); err != nil {
+		return err
+	}
+	if err := validateLength("category", p.Category, 50); err != nil {
+		return err
+	}
+	if err := validateLength("meeting_schedule", p.MeetingSchedule, 200); err != nil {
+		return err
+	}
+	if p.ContactEmail != "" {
+		address, err := mail.ParseAddress(p.ContactEmail)
+		if err != nil || address.Address != p.ContactEmail {
+			return fmt.Errorf("contact_email must be a plain email address")
+		}
+	}
+	if !p.JoinPolicy.IsValid() {
+		return fmt.Errorf("join_policy must be open, approval or invite_only")
+	}
+	if err := validateURL("banner_url", p.BannerUrl); err != nil {
+		return err
+	}
+	if len(p.SocialLinks) > 10 {
+		return fmt.Errorf("at most 10 social links are allowed")
+	}
+	for _, link := range p.SocialLinks {
+		if link.Platform == "" {
+			return fmt.Errorf("social link platform is required")
+		}
+		if err := validateLength("social link platform", link.Platform, 30); err != nil {
+			return err
+		}
+		if link.URL == "" {
+			return fmt.Errorf("social link url is required")
+		}
+		if err := validateURL("social link url", link.URL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -6,6 +6,22 @@ import (
 	"gorm.io/gorm"
 )
 
+// Visibility controls who may read a post.
+type Visibility string
+
+var (
+	VisibilityPublic Visibility = "public"
+	// VisibilityCampus posts are shown to signed-in users only.
+	VisibilityCampus Visibility = "campus"
+	// VisibilityMembers posts are shown to members of the author or of an
+	// accepted co-author.
+	VisibilityMembers Visibility = "members"
+)
+
+func (v Visibility) IsValid() bool {
+	return v == VisibilityPublic || v == VisibilityCampus || v == VisibilityMembers
+}
+
 type Post struct {
 	ID       uint    `json:"id" gorm:"primaryKey"`
 	Content  string  `json:"content"`
@@ -13,12 +29,35 @@ type Post struct {
 	AuthorID uint    `json:"author_id"`
 	Topics   []Topic `json:"topics" gorm:"many2many:post_topics"`
 
+	Coauthors []PostCoauthor `json:"coauthors" gorm:"foreignKey:PostID"`
+
 	LikedBy []User `json:"liked_by" gorm:"many2many:post_users;save_associations:true"`
 	Likes   int    `json:"likes"`
+	Views   int64  `json:"views"`
 
-	Hidden bool `json:"hidden"`
+	Hidden     bool       `json:"hidden"`
+	Visibility Visibility `json:"visibility" gorm:"default:public;index"`
 
 	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
 	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at" gorm:"index"`
 }
+
+// IsPublic reports whether anyone, signed in or not, may read the post.
+func (p *Post) IsPublic() bool {
+	return p.Visibility == "" || p.Visibility == VisibilityPublic
+}
+
+// IsAuthoredBy reports whether userID is the post's author or one of its
+// accepted co-authors. Coauthors must be preloaded.
+func (p *Post) IsAuthoredBy(userID uint) bool {
+	if p.AuthorID == userID {
+		return true
+	}
+	for _, coauthor := range p.Coauthors {
+		if coauthor.OrganizationID == userID && coauthor.Status == CoauthorAccepted {
+			return true
+		}
+	}
+	return false
+}
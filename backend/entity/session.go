@@ -0,0 +1,21 @@
+package entity
+
+import "time"
+
+// Session is a browser session as persisted for Fiber's session middleware.
+// Only a hash of the cookie value is stored, so the table can't be used to
+// hijack sessions. AccountID, UserAgent and IP are set at login.
+type Session struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	KeyHash   string `json:"-" gorm:"uniqueIndex"`
+	Data      []byte `json:"-"`
+	AccountID uint   `json:"account_id" gorm:"index"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	// Current marks the session of the request listing sessions
+	Current bool `json:"current" gorm:"-"`
+
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at" gorm:"index"`
+}
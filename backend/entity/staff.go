@@ -0,0 +1,41 @@
+package entity
+
+import "time"
+
+// StaffRole is a site wide role granted to an account. Staff act through a
+// persona of the matching user role, added to the account with the grant
+// and removed with it.
+type StaffRole string
+
+var (
+	// StaffSuperAdmin is an admin who may also promote and demote staff
+	StaffSuperAdmin StaffRole = "super_admin"
+	StaffAdmin      StaffRole = "admin"
+	StaffModerator  StaffRole = "moderator"
+)
+
+func (r StaffRole) IsValid() bool {
+	return r == StaffSuperAdmin || r == StaffAdmin || r == StaffModerator
+}
+
+// UserRole is the role of the persona the staff role comes with.
+func (r StaffRole) UserRole() Role {
+	if r == StaffModerator {
+		return RoleModerator
+	}
+	return RoleAdmin
+}
+
+// StaffGrant is the staff role of an account. UserID is the persona it
+// comes with. GrantedByAccountID is nil for the bootstrap command.
+type StaffGrant struct {
+	AccountID          uint      `json:"account_id" gorm:"primaryKey;autoIncrement:false"`
+	Role               StaffRole `json:"role"`
+	UserID             uint      `json:"user_id"`
+	GrantedByAccountID *uint     `json:"granted_by_account_id"`
+
+	Account *Account `json:"account,omitempty" gorm:"foreignKey:AccountID"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
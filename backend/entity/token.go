@@ -0,0 +1,47 @@
+package entity
+
+import (
+	"slices"
+	"time"
+)
+
+type TokenScope string
+
+const (
+	ScopePostsRead  TokenScope = "posts:read"
+	ScopePostsWrite TokenScope = "posts:write"
+	ScopeLikes      TokenScope = "likes"
+)
+
+func (s TokenScope) IsValid() bool {
+	switch s {
+	case ScopePostsRead, ScopePostsWrite, ScopeLikes:
+		return true
+	}
+	return false
+}
+
+// AccessToken is a personal access token for scripts and bots. It acts as
+// one persona of the account, limited to its scopes. Only a hash of the
+// token is stored; Prefix is kept to tell tokens apart.
+type AccessToken struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	AccountID uint         `json:"account_id" gorm:"index"`
+	UserID    uint         `json:"user_id"`
+	Name      string       `json:"name"`
+	Prefix    string       `json:"prefix"`
+	TokenHash string       `json:"-" gorm:"uniqueIndex"`
+	Scopes    []TokenScope `json:"scopes" gorm:"serializer:json"`
+
+	CreatedAt  time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func (t *AccessToken) HasScope(scope TokenScope) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func (t *AccessToken) IsExpired(now time.Time) bool {
+	return !now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+type TransferStatus string
+
+var (
+	TransferPending   TransferStatus = "pending"
+	TransferAccepted  TransferStatus = "accepted"
+	TransferCancelled TransferStatus = "cancelled"
+)
+
+// OwnershipTransfer hands an organization from one owner account to another.
+// FromAccountID is zero when an admin grants ownership of an organization
+// that has no active owner left.
+type OwnershipTransfer struct {
+	ID                   uint           `json:"id" gorm:"primaryKey"`
+	OrganizationID       uint           `json:"organization_id" gorm:"index"`
+	FromAccountID        uint           `json:"from_account_id"`
+	ToAccountID          uint           `json:"to_account_id" gorm:"index"`
+	ToAccount            Account        `json:"-" gorm:"foreignKey:ToAccountID"`
+	InitiatedByAccountID uint           `json:"initiated_by_account_id"`
+	Status               TransferStatus `json:"status"`
+	ResolvedAt           *time.Time     `json:"resolved_at"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
@@ -0,0 +1,33 @@
+package entity
+
+import "time"
+
+// TwoFactor is an account's TOTP authenticator. It is pending until a first
+// code confirms the app was set up, then EnabledAt is set.
+type TwoFactor struct {
+	AccountID uint   `json:"account_id" gorm:"primaryKey;autoIncrement:false"`
+	Secret    string `json:"-"`
+	// LastStep is the time step of the last accepted code, so each code
+	// works only once
+	LastStep int64 `json:"-"`
+	// FailedAttempts counts wrong codes in a row, and past a limit they
+	// lock the authenticator until LockedUntil
+	FailedAttempts int        `json:"-"`
+	LockedUntil    *time.Time `json:"locked_until"`
+	EnabledAt      *time.Time `json:"enabled_at"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (t *TwoFactor) IsEnabled() bool {
+	return t.EnabledAt != nil
+}
+
+// RecoveryCode is a single use code that stands in for the authenticator.
+// Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	AccountID uint       `json:"account_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
@@ -12,6 +12,7 @@ var (
 	RoleOrganization Role = "organization"
 	RoleStudent      Role = "student"
 	RoleAdmin        Role = "admin"
+	RoleModerator    Role = "moderator"
 )
 
 type User struct {
@@ -19,6 +20,10 @@ type User struct {
 	DisplayName string `json:"display_name"`
 	AvatarUrl   string `json:"avatar_url"`
 	Role        Role   `json:"role"`
+	Verified    bool   `json:"verified"`
+
+	Profile     *OrganizationProfile `json:"profile,omitempty" gorm:"foreignKey:UserID"`
+	MemberCount *int64               `json:"member_count,omitempty" gorm:"-"`
 }
 
 func init() {
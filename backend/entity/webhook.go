@@ -0,0 +1,63 @@
+package entity
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WebhookFormat string
+
+var (
+	WebhookFormatJSON    WebhookFormat = "json"
+	WebhookFormatDiscord WebhookFormat = "discord"
+)
+
+type WebhookDeliveryStatus string
+
+var (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+type Webhook struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	OrganizationID uint          `json:"organization_id" gorm:"index"`
+	URL            string        `json:"url"`
+	Format         WebhookFormat `json:"format"`
+	Active         bool          `json:"active"`
+	Events         []string      `json:"events" gorm:"serializer:json"`
+	Secret         string        `json:"-"`
+
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (w Webhook) Subscribed(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	ID        uint                  `json:"id" gorm:"primaryKey"`
+	WebhookID uint                  `json:"webhook_id" gorm:"index"`
+	Webhook   Webhook               `json:"-" gorm:"foreignKey:WebhookID"`
+	EventType string                `json:"event_type"`
+	Payload   string                `json:"payload"`
+	Status    WebhookDeliveryStatus `json:"status" gorm:"index"`
+
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"autoUpdateTime"`
+}
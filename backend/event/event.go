@@ -0,0 +1,99 @@
+package event
+
+import (
+	"slices"
+	"time"
+
+	"torospace.csudh.edu/api/entity"
+)
+
+type Type string
+
+var (
+	TypePostCreated  Type = "post.created"
+	TypePostLiked    Type = "post.liked"
+	TypePostHidden   Type = "post.hidden"
+	TypePostUnhidden Type = "post.unhidden"
+	TypePostDeleted  Type = "post.deleted"
+	TypePostUpdated  Type = "post.updated"
+
+	Types = []Type{TypePostCreated, TypePostLiked, TypePostHidden, TypePostUnhidden, TypePostDeleted, TypePostUpdated}
+)
+
+func IsValidType(eventType string) bool {
+	for _, t := range Types {
+		if string(t) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type Event struct {
+	ID             uint64 `json:"id"`
+	Type           Type   `json:"type"`
+	PostID         uint   `json:"post_id"`
+	OrganizationID uint   `json:"organization_id"`
+	// CoauthorIDs are the organizations that accepted to co-author the post
+	CoauthorIDs []uint       `json:"coauthor_ids,omitempty"`
+	Topics      []string     `json:"topics"`
+	Likes       int          `json:"likes"`
+	Post        *entity.Post `json:"post,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// NewPostEvent builds an event for post. The post body is only attached for
+// events that make a public post visible, so hidden, deleted or restricted
+// content never leaves the server through the stream.
+func NewPostEvent(eventType Type, post *entity.Post) *Event {
+	topics := make([]string, 0, len(post.Topics))
+	for _, topic := range post.Topics {
+		topics = append(topics, topic.Name)
+	}
+
+	e := &Event{
+		Type:           eventType,
+		PostID:         post.ID,
+		OrganizationID: post.AuthorID,
+		Topics:         topics,
+		Likes:          post.Likes,
+		CreatedAt:      time.Now(),
+	}
+	for _, coauthor := range post.Coauthors {
+		if coauthor.Status == entity.CoauthorAccepted {
+			e.CoauthorIDs = append(e.CoauthorIDs, coauthor.OrganizationID)
+		}
+	}
+	if post.IsPublic() && (eventType == TypePostCreated || eventType == TypePostUnhidden || eventType == TypePostUpdated) {
+		e.Post = post
+	}
+	return e
+}
+
+// OrganizationIDs are the organizations the event's post belongs to: its
+// author and accepted co-authors.
+func (e *Event) OrganizationIDs() []uint {
+	return append([]uint{e.OrganizationID}, e.CoauthorIDs...)
+}
+
+// Filter limits a subscription to a single organization and/or topic. The
+// zero value matches every event.
+type Filter struct {
+	OrganizationID uint
+	Topic          string
+}
+
+func (f Filter) Matches(e *Event) bool {
+	if f.OrganizationID != 0 && !slices.Contains(e.OrganizationIDs(), f.OrganizationID) {
+		return false
+	}
+	if f.Topic == "" {
+		return true
+	}
+	for _, topic := range e.Topics {
+		if topic == f.Topic {
+			return true
+		}
+	}
+	return false
+}
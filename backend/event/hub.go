@@ -0,0 +1,88 @@
+package event
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Hub fans events out to every matching subscription in memory. Publishing
+// never blocks: a subscriber whose buffer is full misses the event and is
+// told how many it missed, so it can resync instead of stalling everyone else.
+type Hub struct {
+	subscriptions map[*Subscription]struct{}
+	bufferSize    int
+	lastID        atomic.Uint64
+	sync.RWMutex
+}
+
+type Subscription struct {
+	filter  Filter
+	events  chan *Event
+	dropped atomic.Uint64
+}
+
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = 64
+	}
+	return &Hub{
+		subscriptions: map[*Subscription]struct{}{},
+		bufferSize:    bufferSize,
+	}
+}
+
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	h.Lock()
+	defer h.Unlock()
+
+	sub := &Subscription{
+		filter: filter,
+		events: make(chan *Event, h.bufferSize),
+	}
+	h.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.Lock()
+	defer h.Unlock()
+
+	if _, ok := h.subscriptions[sub]; !ok {
+		return
+	}
+	delete(h.subscriptions, sub)
+	close(sub.events)
+}
+
+func (h *Hub) Publish(e *Event) {
+	h.RLock()
+	defer h.RUnlock()
+
+	e.ID = h.lastID.Add(1)
+	for sub := range h.subscriptions {
+		if !sub.filter.Matches(e) {
+			continue
+		}
+		select {
+		case sub.events <- e:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+func (h *Hub) Count() int {
+	h.RLock()
+	defer h.RUnlock()
+
+	return len(h.subscriptions)
+}
+
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// TakeDropped returns how many events were dropped since the last call.
+func (s *Subscription) TakeDropped() uint64 {
+	return s.dropped.Swap(0)
+}
@@ -0,0 +1,161 @@
+package feed
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+type Item struct {
+	ID         string
+	Title      string
+	Link       string
+	Content    string
+	Author     string
+	Categories []string
+	Published  time.Time
+	Updated    time.Time
+}
+
+// Feed is a format independent feed that can be rendered as RSS 2.0 or Atom.
+type Feed struct {
+	Title       string
+	Link        string
+	SelfLink    string
+	Description string
+	Updated     time.Time
+	Items       []Item
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+	PubDate     string   `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Links   []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Link       atomLink       `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomAuthor     `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+func (f *Feed) RSS() ([]byte, error) {
+	doc := rss{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			AtomLink:    atomLink{Href: f.SelfLink, Rel: "self", Type: "application/rss+xml"},
+			Description: f.Description,
+		},
+	}
+	if !f.Updated.IsZero() {
+		doc.Channel.LastBuildDate = f.Updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, item := range f.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{IsPermaLink: false, Value: item.ID},
+			Description: item.Content,
+			Categories:  item.Categories,
+			PubDate:     item.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return marshal(doc)
+}
+
+func (f *Feed) Atom() ([]byte, error) {
+	doc := atomFeed{
+		NS:    "http://www.w3.org/2005/Atom",
+		ID:    f.SelfLink,
+		Title: f.Title,
+		Links: []atomLink{
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+			{Href: f.SelfLink, Rel: "self", Type: "application/atom+xml"},
+		},
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+	}
+	for _, item := range f.Items {
+		entry := atomEntry{
+			ID:        item.ID,
+			Title:     item.Title,
+			Link:      atomLink{Href: item.Link, Rel: "alternate", Type: "text/html"},
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   item.Updated.UTC().Format(time.RFC3339),
+			Author:    atomAuthor{Name: item.Author},
+			Content:   atomContent{Type: "text", Value: item.Content},
+		}
+		for _, category := range item.Categories {
+			entry.Categories = append(entry.Categories, atomCategory{Term: category})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return marshal(doc)
+}
+
+func marshal(doc any) ([]byte, error) {
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
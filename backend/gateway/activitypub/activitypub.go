@@ -0,0 +1,170 @@
+package activitypub
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+const (
+	ContentType   = "application/activity+json"
+	PublicAddress = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+var (
+	Context = []string{
+		"https://www.w3.org/ns/activitystreams",
+		"https://w3id.org/security/v1",
+	}
+)
+
+// SameOrigin reports whether every URL has the same scheme and host, which
+// ties a remote key to the actor and inboxes served next to it.
+func SameOrigin(first string, others ...string) bool {
+	origin := func(rawURL string) string {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Host == "" {
+			return ""
+		}
+		return strings.ToLower(u.Scheme + "://" + u.Host)
+	}
+	want := origin(first)
+	if want == "" {
+		return false
+	}
+	for _, other := range others {
+		if origin(other) != want {
+			return false
+		}
+	}
+	return true
+}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type Image struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type Endpoints struct {
+	SharedInbox string `json:"sharedInbox,omitempty"`
+}
+
+type Actor struct {
+	Context           any        `json:"@context,omitempty"`
+	ID                string     `json:"id"`
+	Type              string     `json:"type"`
+	PreferredUsername string     `json:"preferredUsername"`
+	Name              string     `json:"name"`
+	Summary           string     `json:"summary,omitempty"`
+	URL               string     `json:"url,omitempty"`
+	Icon              *Image     `json:"icon,omitempty"`
+	Inbox             string     `json:"inbox"`
+	Outbox            string     `json:"outbox"`
+	Followers         string     `json:"followers,omitempty"`
+	Endpoints         *Endpoints `json:"endpoints,omitempty"`
+	PublicKey         PublicKey  `json:"publicKey"`
+}
+
+type Tag struct {
+	Type string `json:"type"`
+	Href string `json:"href"`
+	Name string `json:"name"`
+}
+
+type Note struct {
+	Context      any      `json:"@context,omitempty"`
+	ID           string   `json:"id"`
+	Type         string   `json:"type"`
+	AttributedTo string   `json:"attributedTo"`
+	Content      string   `json:"content"`
+	URL          string   `json:"url,omitempty"`
+	Published    string   `json:"published"`
+	Updated      string   `json:"updated,omitempty"`
+	To           []string `json:"to"`
+	CC           []string `json:"cc,omitempty"`
+	Tag          []Tag    `json:"tag,omitempty"`
+}
+
+type Tombstone struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+}
+
+// Activity is used both for outgoing activities and for decoding incoming
+// ones, so Object is kept raw until the activity type is known.
+type Activity struct {
+	Context   any             `json:"@context,omitempty"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Object    json.RawMessage `json:"object"`
+	Published string          `json:"published,omitempty"`
+	To        []string        `json:"to,omitempty"`
+	CC        []string        `json:"cc,omitempty"`
+}
+
+type OrderedCollection struct {
+	Context      any    `json:"@context,omitempty"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	TotalItems   int    `json:"totalItems"`
+	OrderedItems []any  `json:"orderedItems,omitempty"`
+}
+
+type WebFingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type,omitempty"`
+	Href string `json:"href"`
+}
+
+type WebFinger struct {
+	Subject string          `json:"subject"`
+	Aliases []string        `json:"aliases,omitempty"`
+	Links   []WebFingerLink `json:"links"`
+}
+
+// NewActivity wraps object in an activity of the given type.
+func NewActivity(id string, activityType string, actor string, object any) (*Activity, error) {
+	raw, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	return &Activity{
+		Context: Context,
+		ID:      id,
+		Type:    activityType,
+		Actor:   actor,
+		Object:  raw,
+	}, nil
+}
+
+// ObjectID returns the id of the activity's object, which may be either a
+// bare IRI or an embedded object.
+func (a *Activity) ObjectID() string {
+	var id string
+	if err := json.Unmarshal(a.Object, &id); err == nil {
+		return id
+	}
+	object := struct {
+		ID string `json:"id"`
+	}{}
+	if err := json.Unmarshal(a.Object, &object); err == nil {
+		return object.ID
+	}
+	return ""
+}
+
+// ObjectActivity decodes an embedded activity, such as the Follow in an Undo.
+func (a *Activity) ObjectActivity() (*Activity, error) {
+	inner := &Activity{}
+	if err := json.Unmarshal(a.Object, inner); err != nil {
+		return nil, err
+	}
+	return inner, nil
+}
@@ -0,0 +1,144 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"torospace.csudh.edu/api/gateway/netguard"
+)
+
+// ActivityPubGateway talks to remote ActivityPub servers.
+type ActivityPubGateway interface {
+	// FetchActor returns the remote actor that publishes keyID, found at keyID
+	// or at the owner of the key document there.
+	FetchActor(ctx context.Context, keyID string) (*Actor, error)
+	// Deliver posts a signed activity to a remote inbox.
+	Deliver(ctx context.Context, inbox string, body []byte, keyID string, key *rsa.PrivateKey) (int, error)
+}
+
+type httpActivityPubGateway struct {
+	client    *http.Client
+	allowHTTP bool
+}
+
+// New creates a gateway that only contacts public addresses. allowHTTP
+// permits plain http and local remotes, which is only meant for testing
+// against a local stub inbox.
+func New(allowHTTP bool) ActivityPubGateway {
+	return &httpActivityPubGateway{
+		client:    netguard.NewClient(10*time.Second, allowHTTP),
+		allowHTTP: allowHTTP,
+	}
+}
+
+func (g *httpActivityPubGateway) checkURL(ctx context.Context, rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" || (u.Scheme != "https" && !(g.allowHTTP && u.Scheme == "http")) {
+		return nil, fmt.Errorf("refusing to contact %q", rawURL)
+	}
+	if !g.allowHTTP {
+		if err := netguard.CheckHost(ctx, u.Hostname()); err != nil {
+			return nil, fmt.Errorf("refusing to contact %q: %w", rawURL, err)
+		}
+	}
+	return u, nil
+}
+
+func (g *httpActivityPubGateway) FetchActor(ctx context.Context, keyID string) (*Actor, error) {
+	actor, body, err := g.fetchDocument(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some servers serve the bare key document at keyId. Its owner is
+	// followed once, never further
+	if actor.PublicKey.PublicKeyPem == "" {
+		key := &PublicKey{}
+		// The owner must live next to the key, or any key could claim any actor
+		if err := json.Unmarshal(body, key); err != nil || key.Owner == "" || key.Owner == keyID || !SameOrigin(keyID, key.Owner) {
+			return nil, fmt.Errorf("no public key found at %s", keyID)
+		}
+		if actor, _, err = g.fetchDocument(ctx, key.Owner); err != nil {
+			return nil, err
+		}
+	}
+	if actor.PublicKey.PublicKeyPem == "" || actor.PublicKey.ID != keyID {
+		return nil, fmt.Errorf("actor %q does not publish key %s", actor.ID, keyID)
+	}
+	return actor, nil
+}
+
+// fetchDocument gets the ActivityPub document at rawURL as an actor, with
+// the body for documents that are something else.
+func (g *httpActivityPubGateway) fetchDocument(ctx context.Context, rawURL string) (*Actor, []byte, error) {
+	u, err := g.checkURL(ctx, rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.Fragment = ""
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", ContentType)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, u)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, err
+	}
+	actor := &Actor{}
+	if err := json.Unmarshal(body, actor); err != nil {
+		return nil, nil, err
+	}
+	return actor, body, nil
+}
+
+func (g *httpActivityPubGateway) Deliver(ctx context.Context, inbox string, body []byte, keyID string, key *rsa.PrivateKey) (int, error) {
+	u, err := g.checkURL(ctx, inbox)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("Accept", ContentType)
+	req.Header.Set("User-Agent", "Toro-Space-ActivityPub/1.0")
+	if err := SignRequest(req, body, keyID, key); err != nil {
+		return 0, err
+	}
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,10 @@
+package identity
+
+// NewGoogle is the OpenID Connect provider for Google accounts. The subject
+// is the same ID the old userinfo based login stored as the Google ID.
+// hostedDomain is sent as the hd hint when not empty.
+func NewGoogle(clientID string, clientSecret string, redirectURL string, hostedDomain string) Provider {
+	p := NewOIDC("google", "https://accounts.google.com", clientID, clientSecret, redirectURL).(*oidcProvider)
+	p.hostedDomain = hostedDomain
+	return p
+}
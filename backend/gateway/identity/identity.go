@@ -0,0 +1,156 @@
+package identity
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+// Identity is what a provider asserts about the person who just logged in.
+// Subject is stable per provider; Email may change over time.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Picture       string
+	// HostedDomain is Google's hd claim, empty for other providers
+	HostedDomain string
+}
+
+// LoginAttempt holds the single use secrets of one login, kept in the
+// browser's session between the redirect to the provider and the callback.
+type LoginAttempt struct {
+	// State must come back unchanged on the callback (CSRF)
+	State string
+	// Nonce must come back inside the ID token (replay)
+	Nonce string
+	// Verifier is the PKCE code verifier sent with the code exchange
+	Verifier string
+}
+
+func NewLoginAttempt() (*LoginAttempt, error) {
+	state, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	return &LoginAttempt{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+	}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Provider is one way of logging in.
+type Provider interface {
+	// Name is the provider's path segment, as in /auth/:provider
+	Name() string
+	// AuthURL returns where to send the browser to start a login.
+	AuthURL(ctx context.Context, attempt *LoginAttempt) (string, error)
+	// Exchange turns the code passed to the callback into an identity,
+	// checking it against the attempt that started the login.
+	Exchange(ctx context.Context, code string, attempt *LoginAttempt) (*Identity, error)
+}
+
+// ParseDomains splits a comma separated list of email domains.
+func ParseDomains(list string) []string {
+	var domains []string
+	for _, domain := range strings.Split(list, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// emailTrustedIssuers are the issuers whose verified emails are known to
+// belong to the person logging in. Any other provider, the dev login
+// included, may assert an email someone else uses here.
+var emailTrustedIssuers = []string{"https://accounts.google.com"}
+
+// TrustsEmail reports whether a verified email from provider is enough to
+// link its first login to the existing account with that email.
+func TrustsEmail(provider Provider) bool {
+	p, ok := provider.(*oidcProvider)
+	return ok && slices.Contains(emailTrustedIssuers, p.issuer)
+}
+
+// EmailDomain returns the lowercased domain of an email address.
+func EmailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// FromEnv returns the providers enabled in the environment, keyed by name.
+// allowedDomains are the campus email domains, used to hint the account
+// chooser of providers that support it.
+//
+// Google is enabled by G_CLIENT_ID, a generic OpenID Connect provider by
+// OIDC_ISSUER and the dev provider by AUTH_DEV_ENABLED=true.
+func FromEnv(allowedDomains []string) map[string]Provider {
+	providers := map[string]Provider{}
+
+	if clientID := os.Getenv("G_CLIENT_ID"); clientID != "" {
+		// hd takes a single domain. With several there is no hint, since
+		// "*" would turn away personal accounts that have a login exception
+		hostedDomain := ""
+		if len(allowedDomains) == 1 {
+			hostedDomain = allowedDomains[0]
+		}
+		providers["google"] = NewGoogle(clientID, os.Getenv("G_CLIENT_SECRET"), os.Getenv("G_REDIRECT"), hostedDomain)
+	}
+
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		name := os.Getenv("OIDC_NAME")
+		if name == "" {
+			name = "oidc"
+		}
+		providers[name] = NewOIDC(name, issuer, os.Getenv("OIDC_CLIENT_ID"), os.Getenv("OIDC_CLIENT_SECRET"), os.Getenv("OIDC_REDIRECT"))
+	}
+
+	if os.Getenv("AUTH_DEV_ENABLED") == "true" {
+		log.Println("Dev login is enabled; anyone can log in as anyone")
+		apiURL := os.Getenv("API_URL")
+		if apiURL == "" {
+			apiURL = "http://localhost:3030"
+		}
+		providers["dev"] = NewDev(apiURL)
+	}
+
+	return providers
+}
+
+// Names lists the providers in a stable order.
+func Names(providers map[string]Provider) []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
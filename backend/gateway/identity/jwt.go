@@ -0,0 +1,205 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the provider's clock may be ahead of or behind ours.
+const clockSkew = time.Minute
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// publicKeys returns the usable signing keys by key ID, skipping any it
+// does not understand.
+func (s *jsonWebKeySet) publicKeys() map[string]crypto.PublicKey {
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range s.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil || len(e) > 4 {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+	return keys
+}
+
+// audience is the aud claim, which may be a single string or a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// looseBool accepts "true" as well as true, since some providers send
+// email_verified as a string.
+type looseBool bool
+
+func (b *looseBool) UnmarshalJSON(data []byte) error {
+	*b = looseBool(string(data) == "true" || string(data) == `"true"`)
+	return nil
+}
+
+type idTokenClaims struct {
+	Issuer        string    `json:"iss"`
+	Subject       string    `json:"sub"`
+	Audience      audience  `json:"aud"`
+	AuthorizedBy  string    `json:"azp"`
+	Expiry        int64     `json:"exp"`
+	IssuedAt      int64     `json:"iat"`
+	Nonce         string    `json:"nonce"`
+	Email         string    `json:"email"`
+	EmailVerified looseBool `json:"email_verified"`
+	GivenName     string    `json:"given_name"`
+	FamilyName    string    `json:"family_name"`
+	Picture       string    `json:"picture"`
+	HostedDomain  string    `json:"hd"`
+}
+
+// verify checks the ID token's signature against the provider's published
+// keys and its issuer, audience and lifetime.
+func (p *oidcProvider) verify(ctx context.Context, rawIDToken string) (*idTokenClaims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id_token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id_token header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("malformed id_token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id_token signature: %w", err)
+	}
+	key, err := p.getKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(header.Alg, key, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed id_token payload: %w", err)
+	}
+	claims := &idTokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("malformed id_token payload: %w", err)
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("id_token issuer %q does not match %q", claims.Issuer, p.issuer)
+	}
+	if !slices.Contains(claims.Audience, p.clientID) {
+		return nil, fmt.Errorf("id_token is not for client %q", p.clientID)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedBy != p.clientID {
+		return nil, fmt.Errorf("id_token azp %q does not match client", claims.AuthorizedBy)
+	}
+	now := time.Now()
+	if now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("id_token expired")
+	}
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("id_token issued in the future")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("id_token has no subject")
+	}
+	return claims, nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, digest []byte, signature []byte) error {
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match alg %s", alg)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, signature)
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("key does not match alg %s", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("invalid id_token signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported id_token alg %q", alg)
+	}
+}
@@ -0,0 +1,207 @@
+package identity
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// jwksRefreshInterval limits how often an unknown key ID triggers a refetch
+// of the provider's signing keys.
+const jwksRefreshInterval = 5 * time.Minute
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider logs in with any OpenID Connect provider. The discovery
+// document and signing keys are fetched on first use and cached.
+type oidcProvider struct {
+	name     string
+	issuer   string
+	clientID string
+	secret   string
+	redirect string
+	client   *http.Client
+	// hostedDomain is Google's hd hint for the account chooser
+	hostedDomain string
+
+	mu          sync.Mutex
+	discovery   *discoveryDocument
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+func NewOIDC(name string, issuer string, clientID string, clientSecret string, redirectURL string) Provider {
+	return &oidcProvider{
+		name:     name,
+		issuer:   strings.TrimSuffix(issuer, "/"),
+		clientID: clientID,
+		secret:   clientSecret,
+		redirect: redirectURL,
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (p *oidcProvider) Name() string {
+	return p.name
+}
+
+func (p *oidcProvider) AuthURL(ctx context.Context, attempt *LoginAttempt) (string, error) {
+	config, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("nonce", attempt.Nonce),
+		oauth2.S256ChallengeOption(attempt.Verifier),
+	}
+	if p.hostedDomain != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("hd", p.hostedDomain))
+	}
+	return config.AuthCodeURL(attempt.State, opts...), nil
+}
+
+func (p *oidcProvider) Exchange(ctx context.Context, code string, attempt *LoginAttempt) (*Identity, error) {
+	config, err := p.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(attempt.Verifier))
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, fmt.Errorf("%s returned no id_token", p.name)
+	}
+
+	claims, err := p.verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(attempt.Nonce)) != 1 {
+		return nil, fmt.Errorf("id_token nonce does not match login")
+	}
+
+	return &Identity{
+		Provider:      p.name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		GivenName:     claims.GivenName,
+		FamilyName:    claims.FamilyName,
+		Picture:       claims.Picture,
+		HostedDomain:  claims.HostedDomain,
+	}, nil
+}
+
+func (p *oidcProvider) config(ctx context.Context) (*oauth2.Config, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.secret,
+		RedirectURL:  p.redirect,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+		Scopes: []string{"openid", "email", "profile"},
+	}, nil
+}
+
+func (p *oidcProvider) getDiscovery(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := &discoveryDocument{}
+	if err := p.getJSON(ctx, p.issuer+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", discovery.Issuer, p.issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("incomplete discovery document for %s", p.issuer)
+	}
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// getKey returns the signing key with the given ID, refetching the key set
+// when the ID is unknown since providers rotate keys.
+func (p *oidcProvider) getKey(ctx context.Context, keyID string) (crypto.PublicKey, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[keyID]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", keyID)
+	}
+
+	set := &jsonWebKeySet{}
+	if err := p.getJSON(ctx, discovery.JWKSURI, set); err != nil {
+		return nil, err
+	}
+	p.keys = set.publicKeys()
+	p.keysFetched = time.Now()
+
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", keyID)
+	}
+	return key, nil
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d fetching %s", resp.StatusCode, url)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
@@ -0,0 +1,47 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+// fileTransport writes every message to an .eml file so it can be opened in
+// a mail client during local development.
+type fileTransport struct {
+	dir string
+}
+
+func NewFile(dir string) Transport {
+	return &fileTransport{dir: dir}
+}
+
+func (t *fileTransport) Send(_ context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	return os.WriteFile(filepath.Join(t.dir, name), data, 0o644)
+}
+
+// consoleTransport logs the plain text part of every message.
+type consoleTransport struct{}
+
+func NewConsole() Transport {
+	return &consoleTransport{}
+}
+
+func (t *consoleTransport) Send(_ context.Context, msg *Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+	return nil
+}
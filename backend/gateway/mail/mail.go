@@ -0,0 +1,135 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Transport delivers a Message. Implementations must be safe for concurrent use.
+type Transport interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New picks a transport from MAIL_TRANSPORT (smtp, file or console),
+// defaulting to the console so local development never sends real mail.
+func New() Transport {
+	switch os.Getenv("MAIL_TRANSPORT") {
+	case "smtp":
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			port = 587
+		}
+		return NewSMTP(os.Getenv("SMTP_HOST"), port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return NewFile(dir)
+	default:
+		return NewConsole()
+	}
+}
+
+// DefaultFrom is the sender address used when a message does not set one.
+func DefaultFrom() string {
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		return from
+	}
+	return "Toro Space <no-reply@torospace.csudh.edu>"
+}
+
+// Bytes renders msg as a multipart/alternative RFC 5322 message.
+func (msg *Message) Bytes() ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	}
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qpWriter := quotedprintable.NewWriter(partWriter)
+		if _, err := qpWriter.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qpWriter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	from := msg.From
+	if from == "" {
+		from = DefaultFrom()
+	}
+	headers := map[string]string{
+		"From":         from,
+		"To":           msg.To,
+		"Subject":      mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date":         time.Now().Format(time.RFC1123Z),
+		"Message-ID":   fmt.Sprintf("<%s@torospace.csudh.edu>", randomID()),
+		"MIME-Version": "1.0",
+		"Content-Type": fmt.Sprintf("multipart/alternative; boundary=%q", writer.Boundary()),
+	}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var out bytes.Buffer
+	for _, key := range keys {
+		fmt.Fprintf(&out, "%s: %s\r\n", key, headers[key])
+	}
+	out.WriteString("\r\n")
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+func randomID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(buf)
+}
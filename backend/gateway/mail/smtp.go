@@ -0,0 +1,92 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+)
+
+type smtpTransport struct {
+	host     string
+	port     int
+	username string
+	password string
+}
+
+func NewSMTP(host string, port int, username, password string) Transport {
+	return &smtpTransport{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+	}
+}
+
+func (t *smtpTransport) Send(ctx context.Context, msg *Message) error {
+	data, err := msg.Bytes()
+	if err != nil {
+		return err
+	}
+
+	from := msg.From
+	if from == "" {
+		from = DefaultFrom()
+	}
+	fromAddress, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	toAddress, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid to address: %w", err)
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(t.host, strconv.Itoa(t.port)))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: t.host}); err != nil {
+			return err
+		}
+	}
+	if t.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.username, t.password, t.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(fromAddress.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(toAddress.Address); err != nil {
+		return err
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
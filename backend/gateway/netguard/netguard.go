@@ -0,0 +1,97 @@
+// Package netguard keeps outbound requests to user supplied URLs away from
+// the server's own network: loopback, private, link-local and unspecified
+// addresses are refused when the host is checked and again when dialing,
+// so a DNS answer that changes in between can't get around the check.
+package netguard
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var blockedPrefixes = []netip.Prefix{
+	// "This network" and carrier-grade NAT
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// IsPublic reports whether addr may be contacted.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckHost resolves host and refuses it unless every address is public.
+func CheckHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !IsPublic(addr) {
+			return fmt.Errorf("address %s is not public", addr)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return fmt.Errorf("host %s resolves to %s, which is not public", host, addr)
+		}
+	}
+	return nil
+}
+
+func control(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !IsPublic(addr) {
+		return fmt.Errorf("refusing to dial %s, which is not public", addr)
+	}
+	return nil
+}
+
+// NewClient returns a client that only dials public addresses and never
+// goes through a proxy. allowPrivate turns the guard off, for testing
+// against a receiver on the same machine.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = control
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: timeout,
+		},
+	}
+}
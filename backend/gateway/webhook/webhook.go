@@ -0,0 +1,84 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"torospace.csudh.edu/api/gateway/netguard"
+)
+
+// Request is a single signed POST to a webhook URL.
+type Request struct {
+	URL        string
+	Secret     string
+	EventType  string
+	DeliveryID uint
+	Body       []byte
+}
+
+// WebhookGateway sends webhook requests and reports the response status.
+type WebhookGateway interface {
+	Deliver(ctx context.Context, req *Request) (int, error)
+}
+
+type httpWebhookGateway struct {
+	client *http.Client
+}
+
+// New creates a gateway that only connects to public addresses.
+// allowPrivate lifts that, for testing against a local receiver.
+func New(allowPrivate bool) WebhookGateway {
+	client := netguard.NewClient(10*time.Second, allowPrivate)
+	// Never follow redirects, the registered URL is the only target
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &httpWebhookGateway{
+		client: client,
+	}
+}
+
+// Sign returns the X-Toro-Signature value for body sent at timestamp.
+// Receivers recompute HMAC-SHA256 over "<timestamp>.<body>" with their
+// secret and compare in constant time.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (g *httpWebhookGateway) Deliver(ctx context.Context, req *Request) (int, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "Toro-Space-Webhook/1.0")
+	httpReq.Header.Set("X-Toro-Event", req.EventType)
+	httpReq.Header.Set("X-Toro-Delivery", strconv.FormatUint(uint64(req.DeliveryID), 10))
+	httpReq.Header.Set("X-Toro-Timestamp", strconv.FormatInt(timestamp, 10))
+	httpReq.Header.Set("X-Toro-Signature", Sign(req.Secret, timestamp, req.Body))
+
+	resp, err := g.client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
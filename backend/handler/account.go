@@ -96,3 +96,21 @@ func GetUserHandler(c *fiber.Ctx) error {
 	}
 	return c.JSON(user)
 }
+
+// GetAccountIdentitiesHandler lists the login providers linked to the account.
+func GetAccountIdentitiesHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetAccountIdentitiesHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	identities, err := db.GetAccountIdentities(account.ID)
+	if err != nil {
+		log.Printf("Failed to get identities in GetAccountIdentitiesHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"identities": identities,
+	})
+}
@@ -0,0 +1,578 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/event"
+	"torospace.csudh.edu/api/gateway/activitypub"
+)
+
+const (
+	activityPubMaxAttempts = 8
+	activityPubOutboxSize  = 20
+)
+
+var (
+	activityPubGateway activitypub.ActivityPubGateway
+)
+
+func init() {
+	activityPubGateway = activitypub.New(os.Getenv("ACTIVITYPUB_ALLOW_HTTP") == "true")
+}
+
+func actorURI(userID uint) string {
+	return fmt.Sprintf("%s/ap/users/%d", apiURL, userID)
+}
+
+func actorKeyID(userID uint) string {
+	return actorURI(userID) + "#main-key"
+}
+
+func postURI(postID uint) string {
+	return fmt.Sprintf("%s/ap/posts/%d", apiURL, postID)
+}
+
+func activityPubDomain() string {
+	u, err := url.Parse(apiURL)
+	if err != nil {
+		return apiURL
+	}
+	return u.Host
+}
+
+// getActivityPubActor is only found for organizations that opted into
+// federation, so anonymous reads never create keys.
+func getActivityPubActor(userID uint) (*entity.ActivityPubActor, error) {
+	return db.GetActivityPubActor(userID)
+}
+
+func sendActivityJSON(c *fiber.Ctx, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	c.Set(fiber.HeaderContentType, activitypub.ContentType+"; charset=utf-8")
+	return c.Send(body)
+}
+
+func postToNote(post *entity.Post) *activitypub.Note {
+	content := "<p>" + strings.ReplaceAll(html.EscapeString(post.Content), "\n", "<br>") + "</p>"
+	note := &activitypub.Note{
+		ID:           postURI(post.ID),
+		Type:         "Note",
+		AttributedTo: actorURI(post.AuthorID),
+		Content:      content,
+		URL:          fmt.Sprintf("%s/posts/%d", siteURL, post.ID),
+		Published:    post.CreatedAt.UTC().Format(time.RFC3339),
+		To:           []string{activitypub.PublicAddress},
+		CC:           []string{actorURI(post.AuthorID) + "/followers"},
+	}
+	for _, topic := range post.Topics {
+		note.Tag = append(note.Tag, activitypub.Tag{
+			Type: "Hashtag",
+			Href: fmt.Sprintf("%s/topics/%s", siteURL, url.PathEscape(topic.Name)),
+			Name: "#" + topic.Name,
+		})
+	}
+	return note
+}
+
+func postToCreate(post *entity.Post) (*activitypub.Activity, error) {
+	note := postToNote(post)
+	activity, err := activitypub.NewActivity(note.ID+"/activity", "Create", note.AttributedTo, note)
+	if err != nil {
+		return nil, err
+	}
+	activity.Published = note.Published
+	activity.To = note.To
+	activity.CC = note.CC
+	return activity, nil
+}
+
+func postToUpdate(post *entity.Post) (*activitypub.Activity, error) {
+	note := postToNote(post)
+	note.Updated = post.UpdatedAt.UTC().Format(time.RFC3339)
+	activity, err := activitypub.NewActivity(fmt.Sprintf("%s#update-%d", note.ID, post.UpdatedAt.UnixNano()), "Update", note.AttributedTo, note)
+	if err != nil {
+		return nil, err
+	}
+	activity.To = note.To
+	activity.CC = note.CC
+	return activity, nil
+}
+
+// federatePostEvent sends post changes to the organization's remote
+// followers: new or unhidden posts as Create, edits as Update, hidden or
+// deleted ones as Delete. Only public posts federate; an edit that restricts
+// a post is sent as Delete.
+func federatePostEvent(e *event.Event) {
+	var activity *activitypub.Activity
+	var err error
+	switch e.Type {
+	case event.TypePostCreated, event.TypePostUnhidden:
+		if e.Post == nil {
+			return
+		}
+		activity, err = postToCreate(e.Post)
+	case event.TypePostUpdated:
+		if e.Post != nil {
+			activity, err = postToUpdate(e.Post)
+			break
+		}
+		fallthrough
+	case event.TypePostHidden, event.TypePostDeleted:
+		activity, err = activitypub.NewActivity(
+			fmt.Sprintf("%s#delete-%d", postURI(e.PostID), time.Now().UnixNano()),
+			"Delete",
+			actorURI(e.OrganizationID),
+			activitypub.Tombstone{ID: postURI(e.PostID), Type: "Tombstone"},
+		)
+		if activity != nil {
+			activity.To = []string{activitypub.PublicAddress}
+		}
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to build activity for post %d: %s", e.PostID, err)
+		return
+	}
+
+	body, err := json.Marshal(activity)
+	if err != nil {
+		log.Printf("Failed to marshal activity for post %d: %s", e.PostID, err)
+		return
+	}
+	if err := db.EnqueueActivityPubDeliveries(e.OrganizationID, body); err != nil {
+		log.Printf("Failed to enqueue activity for post %d: %s", e.PostID, err)
+	}
+	for _, organizationID := range e.CoauthorIDs {
+		federateCoauthorEvent(e, organizationID)
+	}
+}
+
+func announceURI(organizationID uint, postID uint) string {
+	return fmt.Sprintf("%s/announces/%d", actorURI(organizationID), postID)
+}
+
+// federateCoauthorEvent sends a co-authored post to the co-author's remote
+// followers. Activities are signed by the sending actor, so the co-author
+// announces the author's note rather than relaying the author's activities,
+// and undoes the announce once the post is gone.
+func federateCoauthorEvent(e *event.Event, organizationID uint) {
+	announce, err := activitypub.NewActivity(announceURI(organizationID, e.PostID), "Announce", actorURI(organizationID), postURI(e.PostID))
+	if err != nil {
+		log.Printf("Failed to build announce for post %d of co-author %d: %s", e.PostID, organizationID, err)
+		return
+	}
+
+	var activity *activitypub.Activity
+	switch e.Type {
+	case event.TypePostCreated, event.TypePostUnhidden:
+		if e.Post == nil {
+			return
+		}
+		activity = announce
+	case event.TypePostUpdated:
+		// The announce still points at the edited note
+		if e.Post != nil {
+			return
+		}
+		fallthrough
+	case event.TypePostHidden, event.TypePostDeleted:
+		undone := *announce
+		undone.Context = nil
+		activity, err = activitypub.NewActivity(
+			fmt.Sprintf("%s#undo-%d", announce.ID, time.Now().UnixNano()),
+			"Undo",
+			announce.Actor,
+			undone,
+		)
+	default:
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to build activity for post %d of co-author %d: %s", e.PostID, organizationID, err)
+		return
+	}
+	activity.To = []string{activitypub.PublicAddress}
+	activity.CC = []string{actorURI(organizationID) + "/followers"}
+
+	body, err := json.Marshal(activity)
+	if err != nil {
+		log.Printf("Failed to marshal activity for post %d of co-author %d: %s", e.PostID, organizationID, err)
+		return
+	}
+	if err := db.EnqueueActivityPubDeliveries(organizationID, body); err != nil {
+		log.Printf("Failed to enqueue activity for post %d of co-author %d: %s", e.PostID, organizationID, err)
+	}
+}
+
+// StartActivityPubJob delivers queued activities to remote inboxes, retrying
+// failures with the same backoff as webhooks.
+func StartActivityPubJob(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deliverDueActivities(ctx)
+			}
+		}
+	}()
+}
+
+func deliverDueActivities(ctx context.Context) {
+	deliveries, err := db.GetDueActivityPubDeliveries(time.Now(), 50)
+	if err != nil {
+		log.Printf("Failed to get due activity deliveries: %s", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		deliverActivity(ctx, delivery)
+		if err := db.SaveActivityPubDelivery(delivery); err != nil {
+			log.Printf("Failed to save activity delivery %d: %s", delivery.ID, err)
+		}
+	}
+}
+
+func deliverActivity(ctx context.Context, delivery *entity.ActivityPubDelivery) {
+	actor, err := getActivityPubActor(delivery.UserID)
+	if err != nil {
+		delivery.Status = entity.ActivityPubDeliveryFailed
+		delivery.LastError = err.Error()
+		return
+	}
+	key, err := activitypub.ParsePrivateKey(actor.PrivateKeyPem)
+	if err != nil {
+		delivery.Status = entity.ActivityPubDeliveryFailed
+		delivery.LastError = err.Error()
+		return
+	}
+
+	deliverCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	statusCode, err := activityPubGateway.Deliver(deliverCtx, delivery.InboxURL, []byte(delivery.Activity), actorKeyID(delivery.UserID), key)
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		delivery.Status = entity.ActivityPubDeliverySucceeded
+		delivery.LastError = ""
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= activityPubMaxAttempts {
+		delivery.Status = entity.ActivityPubDeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+}
+
+func WebFingerHandler(c *fiber.Ctx) error {
+	resource := c.Query("resource", "")
+	var actor *entity.ActivityPubActor
+	var err error
+
+	if strings.HasPrefix(resource, "acct:") {
+		handle, domain, ok := strings.Cut(strings.TrimPrefix(resource, "acct:"), "@")
+		if !ok || !strings.EqualFold(domain, activityPubDomain()) {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		actor, err = db.GetActivityPubActorByHandle(handle)
+	} else if strings.HasPrefix(resource, apiURL+"/ap/users/") {
+		var userID uint
+		if _, scanErr := fmt.Sscanf(strings.TrimPrefix(resource, apiURL+"/ap/users/"), "%d", &userID); scanErr != nil {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+		actor, err = getActivityPubActor(userID)
+	} else {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if err != nil {
+		log.Printf("Failed to find actor for %q in WebFingerHandler: %s", resource, err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	return c.JSON(activitypub.WebFinger{
+		Subject: fmt.Sprintf("acct:%s@%s", actor.Handle, activityPubDomain()),
+		Aliases: []string{actorURI(actor.UserID)},
+		Links: []activitypub.WebFingerLink{
+			{Rel: "self", Type: activitypub.ContentType, Href: actorURI(actor.UserID)},
+			{Rel: "http://webfinger.net/rel/profile-page", Type: "text/html", Href: fmt.Sprintf("%s/organizations/%d", siteURL, actor.UserID)},
+		},
+	}, "application/jrd+json; charset=utf-8")
+}
+
+func getActivityPubActorParam(c *fiber.Ctx) (*entity.ActivityPubActor, error) {
+	organizationID, err := c.ParamsInt("organizationID", -1)
+	if err != nil || organizationID < 1 {
+		return nil, fmt.Errorf("invalid organizationID %q", c.Params("organizationID"))
+	}
+	return getActivityPubActor(uint(organizationID))
+}
+
+func GetActorHandler(c *fiber.Ctx) error {
+	actor, err := getActivityPubActorParam(c)
+	if err != nil {
+		log.Printf("Failed to get actor in GetActorHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	// Browsers following the actor link land on the organization page
+	if c.Accepts("text/html", activitypub.ContentType, "application/ld+json") == "text/html" {
+		return c.Redirect(fmt.Sprintf("%s/organizations/%d", siteURL, actor.UserID))
+	}
+
+	id := actorURI(actor.UserID)
+	apActor := activitypub.Actor{
+		Context:           activitypub.Context,
+		ID:                id,
+		Type:              "Organization",
+		PreferredUsername: actor.Handle,
+		Name:              actor.User.DisplayName,
+		URL:               fmt.Sprintf("%s/organizations/%d", siteURL, actor.UserID),
+		Inbox:             id + "/inbox",
+		Outbox:            id + "/outbox",
+		Followers:         id + "/followers",
+		PublicKey: activitypub.PublicKey{
+			ID:           actorKeyID(actor.UserID),
+			Owner:        id,
+			PublicKeyPem: actor.PublicKeyPem,
+		},
+	}
+	if actor.User.AvatarUrl != "" {
+		apActor.Icon = &activitypub.Image{Type: "Image", URL: actor.User.AvatarUrl}
+	}
+	return sendActivityJSON(c, apActor)
+}
+
+func GetOutboxHandler(c *fiber.Ctx) error {
+	actor, err := getActivityPubActorParam(c)
+	if err != nil {
+		log.Printf("Failed to get actor in GetOutboxHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	posts, total, err := db.GetPublicPostsByAuthor(actor.UserID, activityPubOutboxSize)
+	if err != nil {
+		log.Printf("Failed to get posts in GetOutboxHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	items := make([]any, 0, len(posts))
+	for _, post := range posts {
+		activity, err := postToCreate(post)
+		if err != nil {
+			log.Printf("Failed to build activity in GetOutboxHandler: %s", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		activity.Context = nil
+		items = append(items, activity)
+	}
+
+	return sendActivityJSON(c, activitypub.OrderedCollection{
+		Context:      activitypub.Context,
+		ID:           actorURI(actor.UserID) + "/outbox",
+		Type:         "OrderedCollection",
+		TotalItems:   int(total),
+		OrderedItems: items,
+	})
+}
+
+func GetFollowersHandler(c *fiber.Ctx) error {
+	actor, err := getActivityPubActorParam(c)
+	if err != nil {
+		log.Printf("Failed to get actor in GetFollowersHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	count, err := db.CountActivityPubFollowers(actor.UserID)
+	if err != nil {
+		log.Printf("Failed to count followers in GetFollowersHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	// Only the count is public, follower identities are not listed
+	return sendActivityJSON(c, activitypub.OrderedCollection{
+		Context:    activitypub.Context,
+		ID:         actorURI(actor.UserID) + "/followers",
+		Type:       "OrderedCollection",
+		TotalItems: int(count),
+	})
+}
+
+// EnableFederationHandler opts the organization into federation, creating
+// its actor and signing key.
+func EnableFederationHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	actor, err := db.EnableActivityPubActor(organizationID, activitypub.GenerateKeyPair)
+	if err != nil {
+		log.Printf("Failed to enable federation in EnableFederationHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	return c.JSON(fiber.Map{
+		"handle": fmt.Sprintf("@%s@%s", actor.Handle, activityPubDomain()),
+		"actor":  actorURI(actor.UserID),
+	})
+}
+
+// DisableFederationHandler removes the actor, its keys and its followers.
+func DisableFederationHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	if err := db.DisableActivityPubActor(organizationID); err != nil {
+		log.Printf("Failed to disable federation in DisableFederationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func GetActivityPubPostHandler(c *fiber.Ctx) error {
+	postID, err := c.ParamsInt("postID", -1)
+	if err != nil || postID < 1 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	post, err := db.GetPost(uint(postID))
+	if err != nil || post.Hidden || !post.IsPublic() || post.Author.Role != entity.RoleOrganization {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if _, err := getActivityPubActor(post.AuthorID); err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	note := postToNote(post)
+	note.Context = activitypub.Context
+	return sendActivityJSON(c, note)
+}
+
+// InboxHandler accepts Follow and Undo Follow from remote servers. Every
+// request must carry a valid HTTP signature from the actor it claims to be.
+func InboxHandler(c *fiber.Ctx) error {
+	actor, err := getActivityPubActorParam(c)
+	if err != nil {
+		log.Printf("Failed to get actor in InboxHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	sig, err := activitypub.ParseSignature(c.Get("Signature"))
+	if err != nil {
+		log.Printf("Invalid signature in InboxHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	// The gateway refuses keyIds on private addresses before fetching. The
+	// request context has no deadline, so the fetch gets its own
+	fetchCtx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	remote, err := activityPubGateway.FetchActor(fetchCtx, sig.KeyID)
+	if err != nil {
+		log.Printf("Failed to fetch signing actor in InboxHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	// A key only speaks for the actor and inboxes on its own server
+	inbox := remote.Inbox
+	if remote.Endpoints != nil && remote.Endpoints.SharedInbox != "" {
+		inbox = remote.Endpoints.SharedInbox
+	}
+	if remote.PublicKey.ID != sig.KeyID || remote.PublicKey.Owner != remote.ID ||
+		!activitypub.SameOrigin(sig.KeyID, remote.ID, remote.Inbox, inbox) {
+		log.Printf("Key %q does not belong to actor %q in InboxHandler", sig.KeyID, remote.ID)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	key, err := activitypub.ParsePublicKey(remote.PublicKey.PublicKeyPem)
+	if err != nil {
+		log.Printf("Failed to parse remote key in InboxHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	body := c.Body()
+	getHeader := func(name string) string {
+		return c.Get(name)
+	}
+	if err := activitypub.VerifyRequest(sig, c.Method(), c.OriginalURL(), body, getHeader, key); err != nil {
+		log.Printf("Failed to verify signature in InboxHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	activity := &activitypub.Activity{}
+	if err := json.Unmarshal(body, activity); err != nil {
+		log.Printf("Failed to parse activity in InboxHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if activity.Actor != remote.ID {
+		log.Printf("Activity actor %q does not match signer %q in InboxHandler", activity.Actor, remote.ID)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	switch activity.Type {
+	case "Follow":
+		if activity.ObjectID() != actorURI(actor.UserID) {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		if err := db.AddActivityPubFollower(&entity.ActivityPubFollower{
+			UserID:   actor.UserID,
+			ActorURI: remote.ID,
+			InboxURL: inbox,
+		}); err != nil {
+			log.Printf("Failed to add follower in InboxHandler: %s", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+
+		accept, err := activitypub.NewActivity(
+			fmt.Sprintf("%s#accepts/%d", actorURI(actor.UserID), time.Now().UnixNano()),
+			"Accept",
+			actorURI(actor.UserID),
+			json.RawMessage(body),
+		)
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		acceptBody, err := json.Marshal(accept)
+		if err != nil {
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if err := db.EnqueueActivityPubDelivery(actor.UserID, remote.Inbox, acceptBody); err != nil {
+			log.Printf("Failed to enqueue Accept in InboxHandler: %s", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	case "Undo":
+		inner, err := activity.ObjectActivity()
+		if err != nil || inner.Type != "Follow" {
+			return c.SendStatus(fiber.StatusAccepted)
+		}
+		if err := db.RemoveActivityPubFollower(actor.UserID, remote.ID); err != nil {
+			log.Printf("Failed to remove follower in InboxHandler: %s", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	case "Delete":
+		// The remote account itself was deleted
+		if activity.ObjectID() == remote.ID {
+			if err := db.RemoveActivityPubFollower(actor.UserID, remote.ID); err != nil {
+				log.Printf("Failed to remove follower in InboxHandler: %s", err)
+				return c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+	}
+	return c.SendStatus(fiber.StatusAccepted)
+}
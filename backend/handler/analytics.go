@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/analytics"
+)
+
+type postAnalytics struct {
+	PostID     uint      `json:"post_id"`
+	Excerpt    string    `json:"excerpt"`
+	Topics     []string  `json:"topics"`
+	CreatedAt  time.Time `json:"created_at"`
+	Views      int64     `json:"views"`
+	Likes      int64     `json:"likes"`
+	TotalLikes int       `json:"total_likes"`
+}
+
+type analyticsQuery struct {
+	OrganizationID uint
+	From           time.Time
+	To             time.Time
+	Period         analytics.Period
+	CSV            bool
+}
+
+// getAnalyticsQuery reads the organization, range and format shared by the
+// analytics endpoints. On failure it returns the status to send and, for bad
+// input, an error to show the caller.
+func getAnalyticsQuery(c *fiber.Ctx) (*analyticsQuery, int, error) {
+	organizationID := authorizedOrganizationID(c)
+
+	format := c.Params("format")
+	if format != "" && format != "csv" {
+		return nil, fiber.StatusNotFound, nil
+	}
+
+	period := analytics.Period(c.Query("period", string(analytics.PeriodDay)))
+	if !period.IsValid() {
+		return nil, fiber.StatusBadRequest, fmt.Errorf("period must be day or week")
+	}
+	from, to, err := analytics.ParseRange(c.Query("from"), c.Query("to"), time.Now())
+	if err != nil {
+		return nil, fiber.StatusBadRequest, err
+	}
+	return &analyticsQuery{
+		OrganizationID: organizationID,
+		From:           from,
+		To:             to,
+		Period:         period,
+		CSV:            format == "csv",
+	}, fiber.StatusOK, nil
+}
+
+func sendAnalyticsQueryError(c *fiber.Ctx, status int, err error) error {
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.SendStatus(status)
+}
+
+// csvCell keeps a value that spreadsheets would run as a formula, such as a
+// name picked at the identity provider, as plain text.
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// sendCSV sends rows as a CSV download. Every cell goes through csvCell.
+func sendCSV(c *fiber.Ctx, filename string, rows [][]string) error {
+	for _, row := range rows {
+		for i := range row {
+			row[i] = csvCell(row[i])
+		}
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.WriteAll(rows); err != nil {
+		log.Printf("Failed to write CSV %s: %s", filename, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s"`, filename))
+	return c.Send(buf.Bytes())
+}
+
+func excerpt(content string, max int) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) <= max {
+		return content
+	}
+	return string(runes[:max]) + "…"
+}
+
+// GetOrganizationAnalyticsHandler reports bucketed totals for an
+// organization plus its top topics, as JSON or as CSV without the topics.
+func GetOrganizationAnalyticsHandler(c *fiber.Ctx) error {
+	query, status, err := getAnalyticsQuery(c)
+	if status != fiber.StatusOK {
+		return sendAnalyticsQueryError(c, status, err)
+	}
+	organizationID, from, to := query.OrganizationID, query.From, query.To
+
+	series := analytics.NewSeries(from, to, query.Period)
+
+	stats, err := db.GetPostStats(organizationID, from, to)
+	if err != nil {
+		log.Printf("Failed to get post stats in GetOrganizationAnalyticsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	for _, stat := range stats {
+		day, err := time.Parse(analytics.DayLayout, stat.Day)
+		if err != nil {
+			continue
+		}
+		series.Add(day, analytics.Metrics{Views: stat.Views, Likes: stat.Likes})
+	}
+
+	posts, err := db.GetAnalyticsPosts(organizationID, nil, from, to)
+	if err != nil {
+		log.Printf("Failed to get posts in GetOrganizationAnalyticsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	for _, post := range posts {
+		series.Add(post.CreatedAt, analytics.Metrics{Posts: 1})
+	}
+
+	followed, err := db.GetFollowerTimes(organizationID, from, to)
+	if err != nil {
+		log.Printf("Failed to get followers in GetOrganizationAnalyticsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	for _, t := range followed {
+		series.Add(t, analytics.Metrics{NewFollowers: 1})
+	}
+
+	joined, err := db.GetMemberJoinTimes(organizationID, from, to)
+	if err != nil {
+		log.Printf("Failed to get members in GetOrganizationAnalyticsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	for _, t := range joined {
+		series.Add(t, analytics.Metrics{NewMembers: 1})
+	}
+
+	if query.CSV {
+		rows := [][]string{{"start", "posts", "views", "likes", "new_followers", "new_members"}}
+		for _, bucket := range series.Buckets {
+			rows = append(rows, []string{
+				bucket.Start,
+				strconv.FormatInt(bucket.Posts, 10),
+				strconv.FormatInt(bucket.Views, 10),
+				strconv.FormatInt(bucket.Likes, 10),
+				strconv.FormatInt(bucket.NewFollowers, 10),
+				strconv.FormatInt(bucket.NewMembers, 10),
+			})
+		}
+		return sendCSV(c, fmt.Sprintf("organization-%d-analytics-%s-%s.csv", organizationID, series.From, series.To), rows)
+	}
+
+	topTopics, err := db.GetTopTopics(organizationID, from, to, 10)
+	if err != nil {
+		log.Printf("Failed to get top topics in GetOrganizationAnalyticsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"series":     series,
+		"top_topics": topTopics,
+	})
+}
+
+// GetPostAnalyticsHandler reports views and likes received within the range
+// for each post the organization made or that was engaged with in it.
+func GetPostAnalyticsHandler(c *fiber.Ctx) error {
+	query, status, err := getAnalyticsQuery(c)
+	if status != fiber.StatusOK {
+		return sendAnalyticsQueryError(c, status, err)
+	}
+	organizationID, from, to := query.OrganizationID, query.From, query.To
+
+	stats, err := db.GetPostStats(organizationID, from, to)
+	if err != nil {
+		log.Printf("Failed to get post stats in GetPostAnalyticsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	byPost := map[uint]*postAnalytics{}
+	postIDs := []uint{}
+	for _, stat := range stats {
+		result, ok := byPost[stat.PostID]
+		if !ok {
+			result = &postAnalytics{PostID: stat.PostID}
+			byPost[stat.PostID] = result
+			postIDs = append(postIDs, stat.PostID)
+		}
+		result.Views += stat.Views
+		result.Likes += stat.Likes
+	}
+
+	posts, err := db.GetAnalyticsPosts(organizationID, postIDs, from, to)
+	if err != nil {
+		log.Printf("Failed to get posts in GetPostAnalyticsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	postsResult := make([]*postAnalytics, 0, len(posts))
+	for _, post := range posts {
+		result, ok := byPost[post.ID]
+		if !ok {
+			result = &postAnalytics{PostID: post.ID}
+		}
+		result.Excerpt = excerpt(post.Content, 80)
+		result.CreatedAt = post.CreatedAt
+		result.TotalLikes = post.Likes
+		result.Topics = []string{}
+		for _, topic := range post.Topics {
+			result.Topics = append(result.Topics, topic.Name)
+		}
+		postsResult = append(postsResult, result)
+	}
+	sort.SliceStable(postsResult, func(i, j int) bool {
+		return postsResult[i].Views+postsResult[i].Likes > postsResult[j].Views+postsResult[j].Likes
+	})
+
+	if query.CSV {
+		rows := [][]string{{"post_id", "created_at", "excerpt", "topics", "views", "likes", "total_likes"}}
+		for _, result := range postsResult {
+			rows = append(rows, []string{
+				strconv.FormatUint(uint64(result.PostID), 10),
+				result.CreatedAt.UTC().Format(time.RFC3339),
+				result.Excerpt,
+				strings.Join(result.Topics, " "),
+				strconv.FormatInt(result.Views, 10),
+				strconv.FormatInt(result.Likes, 10),
+				strconv.Itoa(result.TotalLikes),
+			})
+		}
+		return sendCSV(c, fmt.Sprintf("organization-%d-posts-%s-%s.csv", organizationID, from.Format(analytics.DayLayout), to.Format(analytics.DayLayout)), rows)
+	}
+
+	return c.JSON(fiber.Map{
+		"from":  from.Format(analytics.DayLayout),
+		"to":    to.Format(analytics.DayLayout),
+		"posts": postsResult,
+		"count": len(postsResult),
+	})
+}
@@ -0,0 +1,221 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/gateway/mail"
+)
+
+func sendApplicationDecisionEmail(application *entity.OrganizationApplication, comment string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	text := fmt.Sprintf("Hi %s,\n\nYour application to register %s on Toro Space was %s.\n",
+		application.Account.FirstName, application.Name, application.Status)
+	if application.Status == entity.ApplicationApproved {
+		text += fmt.Sprintf("Sign in and select the %s persona to start posting: %s/select\n", application.Name, siteURL)
+	}
+	if comment != "" {
+		text += fmt.Sprintf("\nComment from the reviewer:\n%s\n", comment)
+	}
+
+	err := mailTransport.Send(ctx, &mail.Message{
+		To:      application.Account.Email,
+		Subject: fmt.Sprintf("Your Toro Space application for %s was %s", application.Name, application.Status),
+		Text:    text,
+	})
+	if err != nil {
+		log.Printf("Failed to send application email for %d: %s", application.ID, err)
+	}
+}
+
+func CreateApplicationHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in CreateApplicationHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	reqBody := struct {
+		Name         string `json:"name"`
+		Description  string `json:"description"`
+		AdvisorName  string `json:"advisor_name"`
+		AdvisorEmail string `json:"advisor_email"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in CreateApplicationHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	application := &entity.OrganizationApplication{
+		AccountID:    account.ID,
+		Name:         strings.TrimSpace(reqBody.Name),
+		Description:  strings.TrimSpace(reqBody.Description),
+		AdvisorName:  strings.TrimSpace(reqBody.AdvisorName),
+		AdvisorEmail: strings.TrimSpace(reqBody.AdvisorEmail),
+		Status:       entity.ApplicationPending,
+		Comments:     []entity.ApplicationComment{},
+	}
+	if err := application.Validate(); err != nil {
+		log.Printf("Invalid application in CreateApplicationHandler: %s", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := db.AddOrganizationApplication(application); err != nil {
+		log.Printf("Failed to add application in CreateApplicationHandler: %s", err)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusCreated).JSON(application)
+}
+
+func GetAccountApplicationsHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetAccountApplicationsHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	applications, err := db.GetAccountApplications(account.ID)
+	if err != nil {
+		log.Printf("Failed to get applications in GetAccountApplicationsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"applications": applications,
+	})
+}
+
+func GetApplicationsAdminHandler(c *fiber.Ctx) error {
+	status := entity.ApplicationStatus(c.Query("status", string(entity.ApplicationPending)))
+	if status == "all" {
+		status = ""
+	}
+	applications, err := db.GetOrganizationApplications(status)
+	if err != nil {
+		log.Printf("Failed to get applications in GetApplicationsAdminHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	applicationsResult := make([]fiber.Map, 0, len(applications))
+	for _, application := range applications {
+		applicationsResult = append(applicationsResult, fiber.Map{
+			"application": application,
+			"applicant": fiber.Map{
+				"account_id": application.Account.ID,
+				"first_name": application.Account.FirstName,
+				"last_name":  application.Account.LastName,
+				"email":      application.Account.Email,
+			},
+		})
+	}
+	return c.JSON(fiber.Map{
+		"applications": applicationsResult,
+		"count":        len(applicationsResult),
+	})
+}
+
+func CommentApplicationHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in CommentApplicationHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	applicationID, err := c.ParamsInt("applicationID", -1)
+	if err != nil || applicationID < 1 {
+		log.Println("Failed to get applicationID from params in CommentApplicationHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	reqBody := struct {
+		Body string `json:"body"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil || len(strings.TrimSpace(reqBody.Body)) < 1 {
+		log.Println("Invalid request body in CommentApplicationHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if _, err := db.GetOrganizationApplication(uint(applicationID)); err != nil {
+		log.Printf("Failed to get application in CommentApplicationHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	comment := &entity.ApplicationComment{
+		ApplicationID: uint(applicationID),
+		AccountID:     account.ID,
+		Body:          strings.TrimSpace(reqBody.Body),
+	}
+	if err := db.AddApplicationComment(comment); err != nil {
+		log.Printf("Failed to add comment in CommentApplicationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(comment)
+}
+
+// ReviewApplicationHandler approves or rejects a pending application based on
+// the :decision param. Rejections must say why.
+func ReviewApplicationHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in ReviewApplicationHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	applicationID, err := c.ParamsInt("applicationID", -1)
+	if err != nil || applicationID < 1 {
+		log.Println("Failed to get applicationID from params in ReviewApplicationHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	var status entity.ApplicationStatus
+	switch c.Params("decision") {
+	case "approve":
+		status = entity.ApplicationApproved
+	case "reject":
+		status = entity.ApplicationRejected
+	default:
+		log.Println("Invalid decision in ReviewApplicationHandler")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	reqBody := struct {
+		Comment string `json:"comment"`
+	}{}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&reqBody); err != nil {
+			log.Printf("Failed to parse request body in ReviewApplicationHandler: %s", err)
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+	}
+	comment := strings.TrimSpace(reqBody.Comment)
+	if status == entity.ApplicationRejected && comment == "" {
+		log.Println("Rejection without comment in ReviewApplicationHandler")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "a comment is required when rejecting",
+		})
+	}
+
+	application, err := db.GetOrganizationApplication(uint(applicationID))
+	if err != nil {
+		log.Printf("Failed to get application in ReviewApplicationHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if err := db.ReviewOrganizationApplication(application, account.ID, status, comment); err != nil {
+		log.Printf("Failed to review application in ReviewApplicationHandler: %s", err)
+		return c.SendStatus(fiber.StatusConflict)
+	}
+
+	sendApplicationDecisionEmail(application, comment)
+	return c.JSON(application)
+}
@@ -1,25 +1,131 @@
 package handler
 
 import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
 	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
 	"torospace.csudh.edu/api/entity"
-	"torospace.csudh.edu/api/gateway/googleoauth"
+	"torospace.csudh.edu/api/gateway/identity"
 	"torospace.csudh.edu/api/mapper"
 	"torospace.csudh.edu/api/util"
 )
 
 var (
-	googleGateway googleoauth.GoogleOauthGateway
+	identityProviders map[string]identity.Provider
+	// allowedEmailDomains may log in without a login exception; when empty
+	// any domain may
+	allowedEmailDomains []string
+
+	devLoginTemplate = template.Must(template.New("dev-login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Toro Space dev login</title></head>
+<body>
+<h1>Dev login</h1>
+<p>Log in as any email. Only enabled for local development.</p>
+<form method="post" action="/auth/dev/login">
+<input type="hidden" name="state" value="{{.State}}">
+<input type="hidden" name="nonce" value="{{.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.CodeChallenge}}">
+<p><label>Email <input name="email" list="identities" required></label></p>
+<p><label>First name <input name="given_name"></label></p>
+<p><label>Last name <input name="family_name"></label></p>
+<datalist id="identities">{{range .Identities}}<option value="{{.Email}}">{{.GivenName}} {{.FamilyName}}</option>{{end}}</datalist>
+<button type="submit">Log in</button>
+</form>
+</body>
+</html>
+`))
 )
 
 func init() {
-	googleGateway = googleoauth.NewV2()
+	allowedEmailDomains = identity.ParseDomains(os.Getenv("ALLOWED_EMAIL_DOMAINS"))
+	identityProviders = identity.FromEnv(allowedEmailDomains)
+}
+
+// checkLoginAllowed enforces who may log in: the provider must have verified
+// the email, and it must be in an allowed domain or have a login exception.
+func checkLoginAllowed(ident *identity.Identity) error {
+	if !ident.EmailVerified {
+		return fmt.Errorf("%s has not verified %s", ident.Provider, ident.Email)
+	}
+
+	domain := identity.EmailDomain(ident.Email)
+	// A Workspace account must belong to one of the campus domains, which
+	// may differ from its email's domain when it uses an alias
+	if ident.HostedDomain != "" && !hostedDomainAllowed(ident.HostedDomain, domain) {
+		return fmt.Errorf("%s is in hosted domain %s", ident.Email, ident.HostedDomain)
+	}
+	if len(allowedEmailDomains) == 0 || slices.Contains(allowedEmailDomains, domain) {
+		return nil
+	}
+
+	exception, err := db.GetLoginExceptionByEmail(ident.Email)
+	if err != nil || !exception.IsActive(time.Now()) {
+		return fmt.Errorf("%s is not in an allowed domain", ident.Email)
+	}
+	return nil
+}
+
+// hostedDomainAllowed reports whether a Workspace account of hostedDomain
+// may log in with an email in emailDomain. Without allowed domains the
+// account must belong to its email's own domain.
+func hostedDomainAllowed(hostedDomain string, emailDomain string) bool {
+	hostedDomain = strings.ToLower(hostedDomain)
+	if len(allowedEmailDomains) == 0 {
+		return hostedDomain == emailDomain
+	}
+	return slices.Contains(allowedEmailDomains, hostedDomain)
 }
 
-func GoogleAuthHandler(c *fiber.Ctx) error {
+// GetAuthProvidersHandler lists the enabled login providers so the frontend
+// can link to /auth/:provider for each.
+func GetAuthProvidersHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"providers": identity.Names(identityProviders),
+	})
+}
+
+// saveLoginAttempt binds a new login to the browser's session.
+func saveLoginAttempt(sess *session.Session, provider string, attempt *identity.LoginAttempt) {
+	sess.Set("loginProvider", provider)
+	sess.Set("loginState", attempt.State)
+	sess.Set("loginNonce", attempt.Nonce)
+	sess.Set("loginVerifier", attempt.Verifier)
+}
+
+// takeLoginAttempt removes the session's login attempt so each can be
+// completed only once. ok is false when there is none for the provider.
+func takeLoginAttempt(sess *session.Session, provider string) (*identity.LoginAttempt, bool) {
+	sessProvider, _ := sess.Get("loginProvider").(string)
+	attempt := &identity.LoginAttempt{}
+	attempt.State, _ = sess.Get("loginState").(string)
+	attempt.Nonce, _ = sess.Get("loginNonce").(string)
+	attempt.Verifier, _ = sess.Get("loginVerifier").(string)
+
+	sess.Delete("loginProvider")
+	sess.Delete("loginState")
+	sess.Delete("loginNonce")
+	sess.Delete("loginVerifier")
+
+	ok := sessProvider == provider && attempt.State != "" && attempt.Nonce != "" && attempt.Verifier != ""
+	return attempt, ok
+}
+
+func AuthHandler(c *fiber.Ctx) error {
+	provider, ok := identityProviders[c.Params("provider")]
+	if !ok {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
 	// Check if user is already authenticated
 	session, err := sessionStore.Get(c)
 	if err != nil {
@@ -27,46 +133,90 @@ func GoogleAuthHandler(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	_, ok := session.Get("accountID").(uint)
+	_, ok = session.Get("accountID").(uint)
 	if ok {
-		return c.Redirect("http://localhost:3000/select")
+		return c.Redirect(siteURL + "/select")
+	}
+
+	attempt, err := identity.NewLoginAttempt()
+	if err != nil {
+		log.Printf("Failed to start login: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	authURL, err := provider.AuthURL(c.Context(), attempt)
+	if err != nil {
+		log.Printf("Failed to build %s auth URL: %s", provider.Name(), err)
+		return c.SendStatus(fiber.StatusBadGateway)
 	}
 
-	return c.Redirect(googleGateway.GetAuthUrl())
+	// Short expiry; the attempt only needs to last while the user logs in
+	session.SetExpiry(10 * time.Minute)
+	saveLoginAttempt(session, provider.Name(), attempt)
+	if err := session.Save(); err != nil {
+		log.Printf("Failed to save session: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Redirect(authURL)
 }
 
-func GoogleAuthCallbackHandler(c *fiber.Ctx) error {
-	// Get Auth Code (?code=...)
-	code := c.Query("code")
+func AuthCallbackHandler(c *fiber.Ctx) error {
+	provider, ok := identityProviders[c.Params("provider")]
+	if !ok {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
 
-	// Exchange auth code for token
-	token, err := googleGateway.GetToken(c.Context(), code)
+	session, err := sessionStore.Get(c)
 	if err != nil {
-		log.Printf("Failed to exchange auth code for token: %s", err)
+		log.Printf("Failed to get session: %s", err)
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	// Map to a User
-	googleUser, err := googleGateway.GetUserInfo(token.AccessToken)
-	if err != nil {
-		log.Printf("Failed to map token to GoogleAuth: %s", err)
+	// Whatever happens next the attempt is used up
+	attempt, ok := takeLoginAttempt(session, provider.Name())
+	if err := session.Save(); err != nil {
+		log.Printf("Failed to save session: %s", err)
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
-	var account *entity.Account
-	account, err = db.GetAccountByGoogleID(googleUser.ID)
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Printf("%s login failed: %s %s", provider.Name(), providerErr, c.Query("error_description"))
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if !ok || subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(attempt.State)) != 1 {
+		log.Printf("Rejected %s callback with missing or mismatched state", provider.Name())
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if c.Query("code") == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
 
-	// User does not exist, create a new user
+	// Exchange auth code (?code=...) for the verified identity
+	ident, err := provider.Exchange(c.Context(), c.Query("code"), attempt)
 	if err != nil {
-		account = mapper.GoogleUserToAccount(googleUser)
-		if err := db.AddAccount(account); err != nil {
-			log.Printf("Failed to add user to the database: %s", err)
-			return c.SendStatus(fiber.StatusInternalServerError)
-		}
+		log.Printf("Failed to exchange %s auth code: %s", provider.Name(), err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if ident.Email == "" {
+		log.Printf("No email in %s identity %s", provider.Name(), ident.Subject)
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	if err := checkLoginAllowed(ident); err != nil {
+		log.Printf("Refused %s login: %s", provider.Name(), err)
+		return c.SendStatus(fiber.StatusForbidden)
 	}
 
-	// Store user's internal ID in session
-	session, err := sessionStore.Get(c)
+	// Only a provider that proves the email owns it may take over the
+	// account already using it; others get an account of their own
+	linkByEmail := ident.EmailVerified && identity.TrustsEmail(provider)
+	account, err := db.LoginAccountIdentity(mapper.IdentityToAccountIdentity(ident), linkByEmail, mapper.IdentityToAccount(ident))
+	if err != nil {
+		log.Printf("Failed to log in %s identity: %s", provider.Name(), err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	// Store user's internal ID in a new session so an ID planted before
+	// login is worthless afterwards
+	session, err = sessionStore.Get(c)
 	if err != nil {
 		log.Printf("Failed to get session: %s", err)
 		return c.SendStatus(fiber.StatusInternalServerError)
@@ -76,24 +226,82 @@ func GoogleAuthCallbackHandler(c *fiber.Ctx) error {
 		log.Printf("Failed to regenerate session: %s", err)
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
-	session.Set("accountID", account.ID)
-
-	if account.ID != session.Get("accountID") {
-		log.Println("User ID is not being set properly (sess not set properly)")
-		return c.SendStatus(fiber.StatusInternalServerError)
-	}
 	if account.ID == 0 {
 		log.Println("User ID is not being set properly (0)")
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
+	// With two-factor the session stays logged out until VerifyLoginHandler
+	// accepts a code
+	twoFactor, err := db.HasTwoFactor(account.ID)
+	if err != nil {
+		log.Printf("Failed to check two-factor of account %d: %s", account.ID, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if twoFactor {
+		session.SetExpiry(pendingLoginLimit)
+		session.Set("pendingAccountID", account.ID)
+	} else {
+		session.Set("accountID", account.ID)
+		if account.ID != session.Get("accountID") {
+			log.Println("User ID is not being set properly (sess not set properly)")
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+
+	sessionID := session.ID()
 	if err := session.Save(); err != nil {
 		log.Printf("Failed to save session: %s", err)
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
+	if err := db.SetSessionAccount(sessionID, account.ID, c.Get(fiber.HeaderUserAgent), c.IP()); err != nil {
+		log.Printf("Failed to record session of account %d: %s", account.ID, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
 
-	// Redirect to the login page (or wherever you want to send the user after they log out)
-	return c.Redirect("http://localhost:3000/select")
+	if twoFactor {
+		return c.Redirect(siteURL + "/two-factor")
+	}
+	return c.Redirect(siteURL + "/select")
+}
+
+// DevLoginHandler shows the dev provider's login form.
+func DevLoginHandler(c *fiber.Ctx) error {
+	if _, ok := identityProviders["dev"]; !ok {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	c.Type("html")
+	return devLoginTemplate.Execute(c, fiber.Map{
+		"State":         c.Query("state"),
+		"Nonce":         c.Query("nonce"),
+		"CodeChallenge": c.Query("code_challenge"),
+		"Identities":    identity.DevIdentities,
+	})
+}
+
+// SubmitDevLoginHandler passes the submitted identity to the callback the
+// way a real provider would pass its code.
+func SubmitDevLoginHandler(c *fiber.Ctx) error {
+	if _, ok := identityProviders["dev"]; !ok {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	login := identity.DevLogin{
+		Email:         c.FormValue("email"),
+		GivenName:     c.FormValue("given_name"),
+		FamilyName:    c.FormValue("family_name"),
+		Nonce:         c.FormValue("nonce"),
+		CodeChallenge: c.FormValue("code_challenge"),
+	}
+	if login.Email == "" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	callback := url.Values{}
+	callback.Set("code", login.Code())
+	callback.Set("state", c.FormValue("state"))
+	return c.Redirect("/auth/dev/callback?" + callback.Encode())
 }
 
 func SelectUserHandler(c *fiber.Ctx) error {
@@ -137,6 +345,12 @@ func SelectUserHandler(c *fiber.Ctx) error {
 		log.Printf("Failed to get user from database: %s", err)
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
+	if staffTwoFactorMissing(account.ID, user.Role) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":      "two-factor authentication is required for staff personas",
+			"two_factor": "enroll",
+		})
+	}
 
 	sess.Set("userID", user.ID)
 	sess.Set("userRole", user.Role)
@@ -147,36 +361,38 @@ func SelectUserHandler(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
+// GetCurrentUserHandler returns the selected persona. While an admin is
+// impersonating the account, the impersonation is included so the site can
+// show it.
 func GetCurrentUserHandler(c *fiber.Ctx) error {
-	session, err := sessionStore.Get(c)
+	principal, err := getPrincipal(c)
 	if err != nil {
-		log.Printf("Failed to get session: %s", err)
+		log.Printf("Failed to get principal: %s", err)
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
-
-	sessAccountID, ok := session.Get("accountID").(uint)
-	if !ok {
-		log.Printf("Failed to get accountID from session")
-		return c.SendStatus(fiber.StatusUnauthorized)
-	}
-	sessUserID, ok := session.Get("userID").(uint)
-	if !ok {
+	if principal.UserID == 0 {
 		log.Printf("Failed to get userID from session")
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	account, err := db.GetAccountByID(sessAccountID)
+	account, err := db.GetAccountByID(principal.AccountID)
 	if err != nil {
 		log.Printf("Failed to get user from database: %s", err)
 		return c.SendStatus(fiber.StatusUnauthorized)
 	}
 
-	user, err := util.BinarySearch(account.Users, entity.User{ID: sessUserID})
+	user, err := util.BinarySearch(account.Users, entity.User{ID: principal.UserID})
 	if err != nil {
 		log.Printf("Failed to get user from database: %s", err)
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
-	return c.JSON(user)
+	return c.JSON(struct {
+		entity.User
+		Impersonation *entity.Impersonation `json:"impersonation,omitempty"`
+	}{
+		User:          user,
+		Impersonation: principal.Impersonation,
+	})
 }
 
 func LogoutHandler(c *fiber.Ctx) error {
@@ -187,6 +403,18 @@ func LogoutHandler(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
 
+	// Logging out also ends an impersonation
+	if impersonationID, ok := session.Get("impersonationID").(uint); ok {
+		if impersonation, err := db.GetImpersonation(impersonationID); err == nil {
+			entry := impersonationAuditEntry(impersonation, "impersonation.end", map[string]string{
+				"reason": "logged out",
+			})
+			if err := db.EndImpersonation(impersonation, time.Now(), entry); err != nil {
+				log.Printf("Failed to end impersonation on logout: %s", err)
+			}
+		}
+	}
+
 	// Destroy the session
 	if err := session.Destroy(); err != nil {
 		log.Printf("Failed to destroy session: %s", err)
@@ -194,5 +422,5 @@ func LogoutHandler(c *fiber.Ctx) error {
 	}
 
 	// Redirect to the login page
-	return c.Redirect("http://localhost:3000")
+	return c.Redirect(siteURL)
 }
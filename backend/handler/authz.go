@@ -0,0 +1,271 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/authz"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/util"
+)
+
+// resourceLoaders load the resource an action applies to from the route,
+// keeping it in Locals for the handler.
+var resourceLoaders = map[authz.Action]func(c *fiber.Ctx) (*authz.Resource, int){
+	authz.EditPost:       loadPostResource,
+	authz.DeletePost:     loadPostResource,
+	authz.HidePost:       loadPostResource,
+	authz.InviteCoauthor: loadPostResource,
+	authz.RemoveCoauthor: loadCoauthorResource,
+
+	authz.EditOrganization:      loadOrganizationResource,
+	authz.ViewAnalytics:         loadOrganizationResource,
+	authz.ViewOrganizationAudit: loadOrganizationResource,
+	authz.TransferOrganization:  loadOrganizationResource,
+	authz.FederateOrganization:  loadOrganizationResource,
+	authz.ManageMembers:         loadOrganizationResource,
+	authz.AssignMembers:         loadOrganizationResource,
+	authz.ManageWebhooks:        loadOrganizationResource,
+	authz.AcceptCoauthor:        loadOrganizationResource,
+}
+
+func loadPostResource(c *fiber.Ctx) (*authz.Resource, int) {
+	post, status := getPostFromParams(c)
+	if status != fiber.StatusOK {
+		return nil, status
+	}
+	c.Locals("post", post)
+	return authz.PostResource(post), fiber.StatusOK
+}
+
+// memberRole is the principal's active role in the organization, empty
+// when it is not a member.
+func memberRole(c *fiber.Ctx, organizationID uint) entity.MemberRole {
+	principal, _ := c.Locals("principal").(*authz.Principal)
+	if !principal.Authenticated() {
+		return ""
+	}
+	member, err := db.GetOrganizationMember(organizationID, principal.AccountID)
+	if err != nil || member.Status != entity.MemberStatusActive {
+		return ""
+	}
+	return member.Role
+}
+
+func loadOrganizationResource(c *fiber.Ctx) (*authz.Resource, int) {
+	organizationID, err := c.ParamsInt("organizationID", -1)
+	if err != nil || organizationID < 1 {
+		log.Println("Failed to get organizationID from params")
+		return nil, fiber.StatusBadRequest
+	}
+	c.Locals("organizationID", uint(organizationID))
+	return authz.OrganizationResource(uint(organizationID), memberRole(c, uint(organizationID))), fiber.StatusOK
+}
+
+// loadCoauthorResource is the link between a post and its :organizationID
+// co-author, which either side may remove: the post's author, or the
+// co-author's owners and officers.
+func loadCoauthorResource(c *fiber.Ctx) (*authz.Resource, int) {
+	post, status := getPostFromParams(c)
+	if status != fiber.StatusOK {
+		return nil, status
+	}
+	res, status := loadOrganizationResource(c)
+	if status != fiber.StatusOK {
+		return nil, status
+	}
+	c.Locals("post", post)
+	res.OwnerID = post.AuthorID
+	return res, fiber.StatusOK
+}
+
+// authorizedPost is the post loaded by Authorize for the route's action.
+func authorizedPost(c *fiber.Ctx) *entity.Post {
+	return c.Locals("post").(*entity.Post)
+}
+
+// authorizedOrganizationID is the :organizationID checked by Authorize for
+// the route's action.
+func authorizedOrganizationID(c *fiber.Ctx) uint {
+	return c.Locals("organizationID").(uint)
+}
+
+// LoadPrincipal works out who the request acts as, from an "Authorization:
+// Bearer" access token or else the cookie session, with the persona's role
+// read from the database. Requests without either act as nobody.
+func LoadPrincipal(c *fiber.Ctx) error {
+	if header := c.Get(fiber.HeaderAuthorization); header != "" {
+		principal, err := loadTokenPrincipal(header)
+		if err != nil {
+			log.Printf("Rejected access token in LoadPrincipal: %s", err)
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		c.Locals("principal", principal)
+		return c.Next()
+	}
+
+	principal := &authz.Principal{}
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		log.Printf("Failed to get session in LoadPrincipal: %s", err)
+		c.Locals("principal", principal)
+		return c.Next()
+	}
+	if accountID, ok := sess.Get("accountID").(uint); ok {
+		userID, _ := sess.Get("userID").(uint)
+		if account, err := db.GetAccountByID(accountID); err == nil {
+			principal = newPrincipal(account, userID)
+		} else {
+			log.Printf("Failed to get account %d in LoadPrincipal: %s", accountID, err)
+		}
+	}
+
+	if impersonationID, ok := sess.Get("impersonationID").(uint); ok {
+		impersonation, err := db.GetImpersonation(impersonationID)
+		if err != nil {
+			log.Printf("Failed to get impersonation %d in LoadPrincipal: %s", impersonationID, err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		reason := ""
+		if !impersonation.IsActive(time.Now()) {
+			reason = "expired"
+		} else if grant, err := db.GetStaffGrant(impersonation.AdminAccountID); err != nil || grant.Role.UserRole() != entity.RoleAdmin {
+			reason = "admin demoted"
+		}
+		if reason != "" {
+			if err := endImpersonation(sess, impersonation, reason); err != nil {
+				log.Printf("Failed to end impersonation %d in LoadPrincipal: %s", impersonation.ID, err)
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "impersonation has ended",
+			})
+		}
+		principal.Impersonation = impersonation
+		c.Locals("principal", principal)
+		return impersonatedRequest(c, impersonation)
+	}
+
+	c.Locals("principal", principal)
+	return c.Next()
+}
+
+func newPrincipal(account *entity.Account, userID uint) *authz.Principal {
+	principal := &authz.Principal{AccountID: account.ID}
+	if userID == 0 {
+		return principal
+	}
+	user, err := util.BinarySearch(account.Users, entity.User{ID: userID})
+	if err != nil {
+		return principal
+	}
+	if staffTwoFactorMissing(account.ID, user.Role) {
+		return principal
+	}
+	principal.UserID = user.ID
+	principal.Role = user.Role
+	principal.Officer = user.Role == entity.RoleOrganization && isOrganizationOfficer(account.ID, user.ID)
+	if user.Role == entity.RoleAdmin {
+		grant, err := db.GetStaffGrant(account.ID)
+		principal.SuperAdmin = err == nil && grant.Role == entity.StaffSuperAdmin && grant.UserID == user.ID
+	}
+	return principal
+}
+
+func loadTokenPrincipal(header string) (*authz.Principal, error) {
+	raw, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || raw == "" {
+		return nil, fmt.Errorf("not a bearer token")
+	}
+
+	now := time.Now()
+	token, err := db.GetAccessToken(raw)
+	if err != nil || token.IsExpired(now) {
+		return nil, fmt.Errorf("unknown or expired access token")
+	}
+
+	// The persona may have been removed from the account since
+	account, err := db.GetAccountByID(token.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account of access token %d: %w", token.ID, err)
+	}
+	principal := newPrincipal(account, token.UserID)
+	if principal.UserID == 0 {
+		return nil, fmt.Errorf("access token %d persona is gone", token.ID)
+	}
+	principal.Token = true
+	principal.Scopes = token.Scopes
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > accessTokenTouchInterval {
+		if err := db.TouchAccessToken(token, now); err != nil {
+			log.Printf("Failed to touch access token %d: %s", token.ID, err)
+		}
+	}
+	return principal, nil
+}
+
+// Authorize guards a route with the permission matrix in authz. Access
+// tokens are only accepted on routes guarded by Authorize.
+func Authorize(action authz.Action) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if status := authorize(c, action); status != fiber.StatusOK {
+			return c.SendStatus(status)
+		}
+
+		principal := c.Locals("principal").(*authz.Principal)
+		if principal.Authenticated() && !principal.Token && !authz.Public[action] {
+			if err := refreshSession(c); err != nil {
+				log.Printf("Failed to refresh session in Authorize: %s", err)
+				return c.SendStatus(fiber.StatusForbidden)
+			}
+		}
+		c.Locals("authorized", action)
+		return c.Next()
+	}
+}
+
+// authorize decides action on the route's resource for handlers whose
+// action depends on the request, as Authorize does for whole routes. The
+// status is fiber.StatusOK when the principal may go ahead.
+func authorize(c *fiber.Ctx, action authz.Action) int {
+	principal, _ := c.Locals("principal").(*authz.Principal)
+	if err := authz.Permits(principal, action); err != nil {
+		return denied(c, action, err)
+	}
+
+	var res *authz.Resource
+	if load := resourceLoaders[action]; load != nil {
+		var status int
+		if res, status = load(c); status != fiber.StatusOK {
+			return status
+		}
+	}
+	if err := authz.Decide(principal, action, res); err != nil {
+		return denied(c, action, err)
+	}
+	return fiber.StatusOK
+}
+
+func denied(c *fiber.Ctx, action authz.Action, err error) int {
+	log.Printf("Denied %s on %s: %s", action, c.Path(), err)
+	if errors.Is(err, authz.ErrUnauthenticated) {
+		return fiber.StatusUnauthorized
+	}
+	return fiber.StatusForbidden
+}
+
+// getPrincipal returns who the request acts as without refreshing the
+// session expiry.
+func getPrincipal(c *fiber.Ctx) (*authz.Principal, error) {
+	principal, ok := c.Locals("principal").(*authz.Principal)
+	if !ok || !principal.Authenticated() {
+		return nil, authz.ErrUnauthenticated
+	}
+	if principal.Token && c.Locals("authorized") == nil {
+		return nil, fmt.Errorf("access tokens are not accepted on %s", c.Path())
+	}
+	return principal, nil
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+)
+
+func GetCategoriesHandler(c *fiber.Ctx) error {
+	categories, err := db.GetCategories()
+	if err != nil {
+		log.Printf("Failed to get categories in GetCategoriesHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"categories": categories,
+	})
+}
+
+func CreateCategoryHandler(c *fiber.Ctx) error {
+	category := &entity.Category{}
+	if err := c.BodyParser(category); err != nil {
+		log.Printf("Failed to parse request body in CreateCategoryHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	category.ID = 0
+	category.Slug = strings.ToLower(strings.TrimSpace(category.Slug))
+	category.Name = strings.TrimSpace(category.Name)
+	if err := category.Validate(); err != nil {
+		log.Printf("Invalid category in CreateCategoryHandler: %s", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if _, err := db.GetCategory(category.Slug); err == nil {
+		log.Printf("Category %q already exists in CreateCategoryHandler", category.Slug)
+		return c.SendStatus(fiber.StatusConflict)
+	}
+	if err := db.AddCategory(category); err != nil {
+		log.Printf("Failed to add category in CreateCategoryHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(category)
+}
+
+func DeleteCategoryHandler(c *fiber.Ctx) error {
+	category, err := db.GetCategory(c.Params("slug"))
+	if err != nil {
+		log.Printf("Failed to get category in DeleteCategoryHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if err := db.DeleteCategory(category); err != nil {
+		log.Printf("Failed to delete category in DeleteCategoryHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func SetOrganizationVerifiedHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in SetOrganizationVerifiedHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	organizationID, err := c.ParamsInt("organizationID", -1)
+	if err != nil || organizationID < 1 {
+		log.Println("Failed to get organizationID from params in SetOrganizationVerifiedHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	reqBody := struct {
+		Verified bool `json:"verified"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in SetOrganizationVerifiedHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	organization, err := db.GetOrganization(uint(organizationID))
+	if err != nil || organization.Role != entity.RoleOrganization {
+		log.Println("Failed to get organization in SetOrganizationVerifiedHandler")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	action := "organization.verified"
+	if !reqBody.Verified {
+		action = "organization.unverified"
+	}
+	entry := &entity.AuditEntry{
+		ActorAccountID: account.ID,
+		Action:         action,
+		SubjectType:    "organization",
+		SubjectID:      organization.ID,
+		Details:        map[string]string{},
+	}
+	if err := db.SetOrganizationVerified(organization, reqBody.Verified, entry); err != nil {
+		log.Printf("Failed to set verified in SetOrganizationVerifiedHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(organization)
+}
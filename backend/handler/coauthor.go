@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/event"
+)
+
+func getPostFromParams(c *fiber.Ctx) (*entity.Post, int) {
+	postID, err := c.ParamsInt("postID", -1)
+	if err != nil || postID < 1 {
+		log.Println("Failed to get postID from params")
+		return nil, fiber.StatusBadRequest
+	}
+	post, err := db.GetPost(uint(postID))
+	if err != nil {
+		log.Printf("Failed to get post %d: %s", postID, err)
+		return nil, fiber.StatusNotFound
+	}
+	return post, fiber.StatusOK
+}
+
+// EditPostHandler replaces the content, topics and optionally the visibility
+// of a post. The author and every accepted co-author may edit it.
+func EditPostHandler(c *fiber.Ctx) error {
+	post := authorizedPost(c)
+
+	reqBody := struct {
+		Content    string            `json:"content"`
+		Topics     []string          `json:"topics"`
+		Visibility entity.Visibility `json:"visibility"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in EditPostHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	content := strings.TrimSpace(reqBody.Content)
+	if len(content) < 1 {
+		log.Println("Empty content in EditPostHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	visibility := post.Visibility
+	if reqBody.Visibility != "" {
+		if !reqBody.Visibility.IsValid() {
+			log.Printf("Invalid visibility %q in EditPostHandler", reqBody.Visibility)
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		visibility = reqBody.Visibility
+	}
+
+	topics := []entity.Topic{}
+	for _, topicName := range reqBody.Topics {
+		if topic, err := db.GetTopicByName(topicName); err != nil {
+			log.Printf("Failed to find %v in EditPostHandler: %v", topicName, err)
+		} else {
+			topics = append(topics, *topic)
+		}
+	}
+
+	if err := db.UpdatePost(post, content, visibility, topics); err != nil {
+		log.Printf("Failed to update post in EditPostHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	post, err := db.GetPost(post.ID)
+	if err != nil {
+		log.Printf("Failed to get updated post in EditPostHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if !post.Hidden {
+		publishPostEvent(event.TypePostUpdated, post)
+	}
+	return c.JSON(post)
+}
+
+// InvitePostCoauthorHandler lets the primary author invite another
+// organization to co-author a post.
+func InvitePostCoauthorHandler(c *fiber.Ctx) error {
+	post := authorizedPost(c)
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in InvitePostCoauthorHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	reqBody := struct {
+		OrganizationID uint `json:"organization_id"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in InvitePostCoauthorHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	coauthor, status := invitePostCoauthor(account, post, reqBody.OrganizationID)
+	if status != fiber.StatusCreated {
+		return c.SendStatus(status)
+	}
+	return c.Status(fiber.StatusCreated).JSON(coauthor)
+}
+
+// getCoauthorOrganization checks that organizationID names an organization
+// other than authorID that can be invited to co-author its posts.
+func getCoauthorOrganization(authorID uint, organizationID uint) (*entity.User, int) {
+	if organizationID == authorID {
+		log.Printf("Organization %d can't co-author its own post", organizationID)
+		return nil, fiber.StatusBadRequest
+	}
+	organization, err := db.GetOrganization(organizationID)
+	if err != nil || organization.Role != entity.RoleOrganization {
+		log.Printf("Failed to get organization %d to co-author a post by %d", organizationID, authorID)
+		return nil, fiber.StatusNotFound
+	}
+	return organization, fiber.StatusOK
+}
+
+func invitePostCoauthor(account *entity.Account, post *entity.Post, organizationID uint) (*entity.PostCoauthor, int) {
+	organization, status := getCoauthorOrganization(post.AuthorID, organizationID)
+	if status != fiber.StatusOK {
+		return nil, status
+	}
+	if _, err := db.GetPostCoauthor(post.ID, organization.ID); err == nil {
+		log.Printf("Organization %d was already invited to co-author post %d", organization.ID, post.ID)
+		return nil, fiber.StatusConflict
+	}
+
+	coauthor := &entity.PostCoauthor{
+		PostID:             post.ID,
+		OrganizationID:     organization.ID,
+		Organization:       *organization,
+		Status:             entity.CoauthorInvited,
+		InvitedByAccountID: account.ID,
+	}
+	if err := db.AddPostCoauthor(coauthor); err != nil {
+		log.Printf("Failed to add co-author to post %d: %s", post.ID, err)
+		return nil, fiber.StatusInternalServerError
+	}
+	return coauthor, fiber.StatusCreated
+}
+
+func AcceptPostCoauthorHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	post, status := getPostFromParams(c)
+	if status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+
+	coauthor, err := db.GetPostCoauthor(post.ID, organizationID)
+	if err != nil || coauthor.Status != entity.CoauthorInvited {
+		log.Printf("No co-author invite for %d on post %d in AcceptPostCoauthorHandler", organizationID, post.ID)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	coauthor.Status = entity.CoauthorAccepted
+	if err := db.SavePostCoauthor(coauthor); err != nil {
+		log.Printf("Failed to save co-author in AcceptPostCoauthorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(coauthor)
+}
+
+// RemovePostCoauthorHandler lets the primary author withdraw an invite or
+// drop a co-author, and lets a co-author decline or leave.
+func RemovePostCoauthorHandler(c *fiber.Ctx) error {
+	post := authorizedPost(c)
+	organizationID := authorizedOrganizationID(c)
+
+	coauthor, err := db.GetPostCoauthor(post.ID, organizationID)
+	if err != nil {
+		log.Printf("Failed to get co-author in RemovePostCoauthorHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if err := db.RemovePostCoauthor(coauthor); err != nil {
+		log.Printf("Failed to remove co-author in RemovePostCoauthorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func GetCoauthorInvitesHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	invites, err := db.GetCoauthorInvites(organizationID)
+	if err != nil {
+		log.Printf("Failed to get invites in GetCoauthorInvitesHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"invites": invites,
+	})
+}
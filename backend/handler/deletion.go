@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/gateway/mail"
+)
+
+// accountDeletionGracePeriod is how long a deletion can be cancelled.
+const accountDeletionGracePeriod = 14 * 24 * time.Hour
+
+// accountDeletionBlocker explains why the account can't be deleted yet, or
+// returns nil. Staff must be demoted first, and organizations must not be
+// left with members but no owner.
+func accountDeletionBlocker(accountID uint) (fiber.Map, error) {
+	if _, err := db.GetStaffGrant(accountID); err == nil {
+		return fiber.Map{
+			"error": "staff accounts must be demoted before they can be deleted",
+		}, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	organizations, err := db.GetSoleOwnedOrganizations(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if len(organizations) > 0 {
+		return fiber.Map{
+			"error":         "transfer ownership of these organizations first",
+			"organizations": organizations,
+		}, nil
+	}
+	return nil, nil
+}
+
+func deletionAuditEntry(accountID uint, action string, deletion *entity.AccountDeletion) *entity.AuditEntry {
+	details := map[string]string{}
+	if deletion != nil {
+		details["scheduled_for"] = deletion.ScheduledFor.Format(time.RFC3339)
+	}
+	return &entity.AuditEntry{
+		ActorAccountID: accountID,
+		Action:         action,
+		SubjectType:    "account",
+		SubjectID:      accountID,
+		Details:        details,
+	}
+}
+
+func sendAccountDeletionEmail(account *entity.Account, deletion *entity.AccountDeletion) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	text := fmt.Sprintf("Hi %s,\n\nYour Toro Space account will be deleted on %s.\n"+
+		"Until then you can sign in and cancel the deletion from your account settings: %s\n",
+		account.FirstName, deletion.ScheduledFor.Format("Monday, January 2"), siteURL)
+	err := mailTransport.Send(ctx, &mail.Message{
+		To:      account.Email,
+		Subject: "Your Toro Space account is scheduled for deletion",
+		Text:    text,
+	})
+	if err != nil {
+		log.Printf("Failed to send deletion email for account %d: %s", account.ID, err)
+	}
+}
+
+func GetAccountDeletionHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetAccountDeletionHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	deletion, err := db.GetAccountDeletion(account.ID)
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return c.JSON(deletion)
+}
+
+// RequestAccountDeletionHandler schedules the caller's account for deletion
+// after the grace period. The account's email must be sent back to confirm.
+func RequestAccountDeletionHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in RequestAccountDeletionHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if principal, _ := getPrincipal(c); principal.Impersonation != nil {
+		log.Println("Refusing to delete an impersonated account in RequestAccountDeletionHandler")
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	reqBody := struct {
+		ConfirmEmail string `json:"confirm_email"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in RequestAccountDeletionHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if !strings.EqualFold(strings.TrimSpace(reqBody.ConfirmEmail), account.Email) {
+		log.Println("Confirmation email does not match in RequestAccountDeletionHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if _, err := db.GetAccountDeletion(account.ID); err == nil {
+		return c.SendStatus(fiber.StatusConflict)
+	}
+	blocker, err := accountDeletionBlocker(account.ID)
+	if err != nil {
+		log.Printf("Failed to check account in RequestAccountDeletionHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if blocker != nil {
+		return c.Status(fiber.StatusConflict).JSON(blocker)
+	}
+
+	deletion := &entity.AccountDeletion{
+		AccountID:    account.ID,
+		ScheduledFor: time.Now().Add(accountDeletionGracePeriod),
+	}
+	if err := db.AddAccountDeletion(deletion, deletionAuditEntry(account.ID, "account.deletion_requested", deletion)); err != nil {
+		log.Printf("Failed to add account deletion in RequestAccountDeletionHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	sendAccountDeletionEmail(account, deletion)
+	return c.Status(fiber.StatusCreated).JSON(deletion)
+}
+
+func CancelAccountDeletionHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in CancelAccountDeletionHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	deletion, err := db.GetAccountDeletion(account.ID)
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if err := db.CancelAccountDeletion(deletion, deletionAuditEntry(account.ID, "account.deletion_cancelled", nil)); err != nil {
+		log.Printf("Failed to cancel account deletion in CancelAccountDeletionHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// StartAccountDeletionJob deletes accounts whose grace period is over every
+// hour. Accounts that became staff or sole owners since are retried later.
+func StartAccountDeletionJob(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			deleteDueAccounts()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func deleteDueAccounts() {
+	deletions, err := db.GetDueAccountDeletions(time.Now())
+	if err != nil {
+		log.Printf("Failed to get due account deletions: %s", err)
+		return
+	}
+	for _, deletion := range deletions {
+		blocker, err := accountDeletionBlocker(deletion.AccountID)
+		if err != nil || blocker != nil {
+			log.Printf("Postponing deletion of account %d: %v %v", deletion.AccountID, blocker["error"], err)
+			continue
+		}
+		if err := db.DeleteAccountData(deletion.AccountID, deletionAuditEntry(deletion.AccountID, "account.deleted", nil)); err != nil {
+			log.Printf("Failed to delete account %d: %s", deletion.AccountID, err)
+			continue
+		}
+		log.Printf("Deleted account %d", deletion.AccountID)
+	}
+}
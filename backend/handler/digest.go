@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/digest"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/gateway/mail"
+	"torospace.csudh.edu/api/sqlite"
+)
+
+const digestPeriod = 7 * 24 * time.Hour
+
+var (
+	mailTransport mail.Transport
+)
+
+func init() {
+	mailTransport = mail.New()
+}
+
+// StartDigestJob checks every hour for accounts whose weekly digest is due.
+// Send times are stored per subscription, so restarts never double send.
+func StartDigestJob(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			sendDueDigests(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func sendDueDigests(ctx context.Context) {
+	accounts, err := db.GetDueDigestAccounts(time.Now().Add(-digestPeriod))
+	if err != nil {
+		log.Printf("Failed to get due digest accounts: %s", err)
+		return
+	}
+
+	for _, account := range accounts {
+		if ctx.Err() != nil {
+			return
+		}
+		subscription, err := db.GetDigestSubscription(account.ID)
+		if err != nil {
+			log.Printf("Failed to get digest subscription for account %d: %s", account.ID, err)
+			continue
+		}
+		msg, err := buildDigest(account, subscription)
+		if err != nil {
+			log.Printf("Failed to build digest for account %d: %s", account.ID, err)
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err = mailTransport.Send(sendCtx, msg)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to send digest to account %d: %s", account.ID, err)
+			continue
+		}
+		if err := db.MarkDigestSent(subscription, time.Now()); err != nil {
+			log.Printf("Failed to mark digest sent for account %d: %s", account.ID, err)
+		}
+	}
+}
+
+func buildDigest(account *entity.Account, subscription *entity.DigestSubscription) (*mail.Message, error) {
+	since := time.Now().Add(-digestPeriod)
+
+	params := &sqlite.TopPostsParams{
+		Since:    since,
+		Limit:    10,
+		Audience: sqlite.PostAudience{AccountID: account.ID},
+	}
+	for _, organization := range subscription.Organizations {
+		params.OrganizationIDs = append(params.OrganizationIDs, organization.ID)
+	}
+	for _, topic := range subscription.Topics {
+		params.TopicIDs = append(params.TopicIDs, topic.ID)
+	}
+
+	posts, err := db.GetTopPosts(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return digest.Build(&digest.Digest{
+		Account:        account,
+		Posts:          posts,
+		Since:          since,
+		SiteURL:        siteURL,
+		UnsubscribeURL: fmt.Sprintf("%s/digest/unsubscribe?token=%s", apiURL, url.QueryEscape(subscription.UnsubscribeToken)),
+	})
+}
+
+func GetDigestSubscriptionHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetDigestSubscriptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	subscription, err := db.GetDigestSubscription(account.ID)
+	if err != nil {
+		log.Printf("Failed to get digest subscription in GetDigestSubscriptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(subscription)
+}
+
+func UpdateDigestSubscriptionHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in UpdateDigestSubscriptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	reqBody := struct {
+		Enabled         bool   `json:"enabled"`
+		OrganizationIDs []uint `json:"organization_ids"`
+		TopicIDs        []uint `json:"topic_ids"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in UpdateDigestSubscriptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	subscription, err := db.GetDigestSubscription(account.ID)
+	if err != nil {
+		log.Printf("Failed to get digest subscription in UpdateDigestSubscriptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	subscription.Enabled = reqBody.Enabled
+	if err := db.UpdateDigestSubscription(subscription, reqBody.OrganizationIDs, reqBody.TopicIDs); err != nil {
+		log.Printf("Failed to update digest subscription in UpdateDigestSubscriptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	subscription, err = db.GetDigestSubscription(account.ID)
+	if err != nil {
+		log.Printf("Failed to get digest subscription in UpdateDigestSubscriptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(subscription)
+}
+
+func PreviewDigestHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in PreviewDigestHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	subscription, err := db.GetDigestSubscription(account.ID)
+	if err != nil {
+		log.Printf("Failed to get digest subscription in PreviewDigestHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	msg, err := buildDigest(account, subscription)
+	if err != nil {
+		log.Printf("Failed to build digest in PreviewDigestHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	if c.Query("format", "html") == "text" {
+		return c.SendString(msg.Text)
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.SendString(msg.HTML)
+}
+
+// UnsubscribeDigestHandler does not need a session, the token in the email
+// link is enough. POST is accepted for one-click List-Unsubscribe.
+func UnsubscribeDigestHandler(c *fiber.Ctx) error {
+	token := c.Query("token", "")
+	if len(token) < 1 {
+		log.Println("Missing token in UnsubscribeDigestHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if err := db.UnsubscribeDigest(token); err != nil {
+		log.Printf("Failed to unsubscribe in UnsubscribeDigestHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return c.JSON(fiber.Map{
+		"message": "You have been unsubscribed from the weekly digest",
+	})
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+)
+
+func loginExceptionAuditEntry(actor *entity.Account, action string, exception *entity.LoginException) *entity.AuditEntry {
+	return &entity.AuditEntry{
+		ActorAccountID: actor.ID,
+		Action:         action,
+		SubjectType:    "login_exception",
+		SubjectID:      exception.ID,
+		Details: map[string]string{
+			"email":  exception.Email,
+			"reason": exception.Reason,
+		},
+	}
+}
+
+func GetLoginExceptionsHandler(c *fiber.Ctx) error {
+	exceptions, err := db.GetLoginExceptions()
+	if err != nil {
+		log.Printf("Failed to get login exceptions in GetLoginExceptionsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"allowed_domains": allowedEmailDomains,
+		"exceptions":      exceptions,
+	})
+}
+
+func CreateLoginExceptionHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in CreateLoginExceptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	exception := &entity.LoginException{}
+	if err := c.BodyParser(exception); err != nil {
+		log.Printf("Failed to parse request body in CreateLoginExceptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	exception.ID = 0
+	exception.Email = strings.ToLower(strings.TrimSpace(exception.Email))
+	exception.Reason = strings.TrimSpace(exception.Reason)
+	exception.AddedByAccountID = account.ID
+	if !strings.Contains(exception.Email, "@") || exception.Reason == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "email and reason are required",
+		})
+	}
+	if exception.ExpiresAt != nil && exception.ExpiresAt.Before(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_at is in the past",
+		})
+	}
+
+	if _, err := db.GetLoginExceptionByEmail(exception.Email); err == nil {
+		log.Printf("Login exception for %s already exists in CreateLoginExceptionHandler", exception.Email)
+		return c.SendStatus(fiber.StatusConflict)
+	}
+	auditEntry := loginExceptionAuditEntry(account, "login_exception.added", exception)
+	if exception.ExpiresAt != nil {
+		auditEntry.Details["expires_at"] = exception.ExpiresAt.Format(time.RFC3339)
+	}
+	if err := db.AddLoginException(exception, auditEntry); err != nil {
+		log.Printf("Failed to add login exception in CreateLoginExceptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(exception)
+}
+
+func DeleteLoginExceptionHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in DeleteLoginExceptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	exceptionID, err := c.ParamsInt("exceptionID", -1)
+	if err != nil || exceptionID < 1 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	exception, err := db.GetLoginException(uint(exceptionID))
+	if err != nil {
+		log.Printf("Failed to get login exception in DeleteLoginExceptionHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	auditEntry := loginExceptionAuditEntry(account, "login_exception.removed", exception)
+	if err := db.DeleteLoginException(exception, auditEntry); err != nil {
+		log.Printf("Failed to delete login exception %d in DeleteLoginExceptionHandler: %s", exception.ID, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
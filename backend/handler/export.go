@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/sqlite"
+)
+
+// exportFiles splits an export into one JSON file per kind of data.
+func exportFiles(export *sqlite.AccountExport) []struct {
+	name string
+	data any
+} {
+	return []struct {
+		name string
+		data any
+	}{
+		{"account.json", export.Account},
+		{"identities.json", export.Identities},
+		{"sessions.json", export.Sessions},
+		{"access_tokens.json", export.AccessTokens},
+		{"two_factor.json", export.TwoFactor},
+		{"recovery_codes.json", export.RecoveryCodes},
+		{"staff_grant.json", export.StaffGrant},
+		{"memberships.json", export.Memberships},
+		{"applications.json", export.Applications},
+		{"ownership_transfers.json", export.OwnershipTransfers},
+		{"digest_subscription.json", export.DigestSubscription},
+		{"likes.json", export.Likes},
+		{"impersonations.json", export.Impersonations},
+		{"audit_entries.json", export.AuditEntries},
+		{"deletion.json", export.Deletion},
+	}
+}
+
+func writeExportZip(export *sqlite.AccountExport) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	for _, file := range exportFiles(export) {
+		w, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportAccountHandler downloads everything stored about the caller's
+// account, as a ZIP of JSON files or with ?format=json a single document.
+func ExportAccountHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in ExportAccountHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if principal, _ := getPrincipal(c); principal.Impersonation != nil {
+		log.Println("Refusing to export an impersonated account in ExportAccountHandler")
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	format := c.Query("format", "zip")
+	if format != "zip" && format != "json" {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	export, err := db.GetAccountExport(account.ID)
+	if err != nil {
+		log.Printf("Failed to export account %d in ExportAccountHandler: %s", account.ID, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	filename := fmt.Sprintf("toro-space-account-%d-%s", account.ID, export.ExportedAt.Format("2006-01-02"))
+	if format == "json" {
+		c.Attachment(filename + ".json")
+		return c.JSON(export)
+	}
+
+	data, err := writeExportZip(export)
+	if err != nil {
+		log.Printf("Failed to write export archive in ExportAccountHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	c.Attachment(filename + ".zip")
+	return c.Send(data)
+}
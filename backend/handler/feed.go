@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/feed"
+	"torospace.csudh.edu/api/sqlite"
+)
+
+const feedPageSize = 20
+
+func feedPostParams(c *fiber.Ctx) *sqlite.PostParams {
+	pageSize := c.QueryInt("page_size", feedPageSize)
+	if pageSize <= 0 || pageSize > 50 {
+		pageSize = feedPageSize
+	}
+	// Feeds are anonymous, so only public posts that are not hidden
+	return &sqlite.PostParams{
+		PageSize:  pageSize,
+		GetHidden: false,
+		Audience:  sqlite.PostAudience{},
+	}
+}
+
+func feedItemTitle(content string) string {
+	title := strings.TrimSpace(strings.SplitN(content, "\n", 2)[0])
+	if runes := []rune(title); len(runes) > 80 {
+		title = string(runes[:77]) + "..."
+	}
+	if title == "" {
+		title = "Untitled post"
+	}
+	return title
+}
+
+func newFeed(title string, link string, description string, posts []*entity.Post) *feed.Feed {
+	f := &feed.Feed{
+		Title:       title,
+		Link:        link,
+		Description: description,
+	}
+	for _, post := range posts {
+		if post.UpdatedAt.After(f.Updated) {
+			f.Updated = post.UpdatedAt
+		}
+		item := feed.Item{
+			ID:        fmt.Sprintf("%s/posts/%d", siteURL, post.ID),
+			Title:     feedItemTitle(post.Content),
+			Link:      fmt.Sprintf("%s/posts/%d", siteURL, post.ID),
+			Content:   post.Content,
+			Author:    post.Author.DisplayName,
+			Published: post.CreatedAt,
+			Updated:   post.UpdatedAt,
+		}
+		for _, topic := range post.Topics {
+			item.Categories = append(item.Categories, topic.Name)
+		}
+		f.Items = append(f.Items, item)
+	}
+	return f
+}
+
+// sendFeed renders f as RSS or Atom, answering conditional GETs with
+// 304 Not Modified when the client already has the current version.
+func sendFeed(c *fiber.Ctx, f *feed.Feed) error {
+	f.SelfLink = apiURL + c.OriginalURL()
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s|%s", c.Params("format"), f.Title)
+	for _, item := range f.Items {
+		fmt.Fprintf(hash, "|%s@%d", item.ID, item.Updated.UnixNano())
+	}
+	etag := fmt.Sprintf("W/\"%s\"", hex.EncodeToString(hash.Sum(nil))[:32])
+
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	if !f.Updated.IsZero() {
+		c.Set(fiber.HeaderLastModified, f.Updated.UTC().Format(http.TimeFormat))
+	}
+
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		if match == etag || match == "*" {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	} else if since := c.Get(fiber.HeaderIfModifiedSince); since != "" && !f.Updated.IsZero() {
+		sinceTime, err := http.ParseTime(since)
+		if err == nil && !f.Updated.Truncate(time.Second).After(sinceTime) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+	}
+
+	var body []byte
+	var err error
+	switch c.Params("format") {
+	case "rss":
+		c.Set(fiber.HeaderContentType, "application/rss+xml; charset=utf-8")
+		body, err = f.RSS()
+	case "atom":
+		c.Set(fiber.HeaderContentType, "application/atom+xml; charset=utf-8")
+		body, err = f.Atom()
+	default:
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("Failed to render feed: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Send(body)
+}
+
+func GetFeedHandler(c *fiber.Ctx) error {
+	postsResult, err := db.GetPosts(feedPostParams(c))
+	if err != nil {
+		log.Printf("Failed to get posts in GetFeedHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	f := newFeed("Toro Space", siteURL, "Latest posts from CSUDH organizations on Toro Space", postsResult.Posts)
+	return sendFeed(c, f)
+}
+
+func GetOrganizationFeedHandler(c *fiber.Ctx) error {
+	organizationID, err := c.ParamsInt("organizationID")
+	if err != nil {
+		log.Println("Failed to get organizationID from params in GetOrganizationFeedHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	organization, err := db.GetOrganization(uint(organizationID))
+	if err != nil || organization.Role != entity.RoleOrganization {
+		log.Println("Failed to get organization in GetOrganizationFeedHandler")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	postsResult, err := db.GetPostsByOrganization(organization.ID, feedPostParams(c))
+	if err != nil {
+		log.Printf("Failed to get posts in GetOrganizationFeedHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	f := newFeed(
+		fmt.Sprintf("%s on Toro Space", organization.DisplayName),
+		fmt.Sprintf("%s/organizations/%d", siteURL, organization.ID),
+		fmt.Sprintf("Latest posts from %s", organization.DisplayName),
+		postsResult.Posts,
+	)
+	return sendFeed(c, f)
+}
+
+func GetTopicFeedHandler(c *fiber.Ctx) error {
+	topic, err := db.GetTopicByName(c.Params("name"))
+	if err != nil {
+		log.Println("Failed to get topic in GetTopicFeedHandler")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	params := feedPostParams(c)
+	params.TopicName = topic.Name
+	postsResult, err := db.GetPosts(params)
+	if err != nil {
+		log.Printf("Failed to get posts in GetTopicFeedHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	f := newFeed(
+		fmt.Sprintf("#%s on Toro Space", topic.Name),
+		fmt.Sprintf("%s/topics/%s", siteURL, topic.Name),
+		fmt.Sprintf("Latest posts tagged #%s", topic.Name),
+		postsResult.Posts,
+	)
+	return sendFeed(c, f)
+}
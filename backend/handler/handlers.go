@@ -1,25 +1,30 @@
 package handler
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/session"
-	"github.com/joho/godotenv"
+	// Loads .env before the init of any file in this package reads it, as
+	// imported packages are initialized first
+	_ "github.com/joho/godotenv/autoload"
+	"torospace.csudh.edu/api/entity"
 	"torospace.csudh.edu/api/sqlite"
+	"torospace.csudh.edu/api/util"
 )
 
 var (
 	db           *sqlite.DB
 	sessionStore *session.Store
+
+	siteURL string
+	apiURL  string
 )
 
 func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatalf("Unable to load .env: %s", err)
-	}
-
 	var err error
 	db, err = sqlite.NewDB()
 	if err != nil {
@@ -28,9 +33,75 @@ func init() {
 
 	sessionStore = session.New(session.Config{
 		Expiration:     30 * time.Minute,
+		Storage:        db.SessionStorage(),
 		CookieHTTPOnly: true,
 		// CookieSecure:  true, // HTTPS only
 	})
+
+	siteURL = getEnvDefault("SITE_URL", "http://localhost:3000")
+	apiURL = getEnvDefault("API_URL", "http://localhost:3030")
+}
+
+func getEnvDefault(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+// refreshSession pushes back the expiry of the caller's cookie session.
+func refreshSession(c *fiber.Ctx) error {
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		return err
+	}
+	sess.SetExpiry(30 * time.Minute)
+	return sess.Save()
+}
+
+// getSessionAccount loads the account of the logged in caller and refreshes
+// the session expiry. When the route has an :accountID param it must be
+// "self" or the caller's own account ID.
+func getSessionAccount(c *fiber.Ctx) (*entity.Account, error) {
+	auth, err := getPrincipal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if param := c.Params("accountID"); param != "" && param != "self" {
+		accountID, err := c.ParamsInt("accountID")
+		if err != nil || uint(accountID) != auth.AccountID {
+			return nil, fmt.Errorf("accountID %q does not match session", param)
+		}
+	}
+
+	if !auth.Token {
+		if err := refreshSession(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return db.GetAccountByID(auth.AccountID)
+}
+
+// getSessionUser is getSessionAccount plus the user selected through
+// SelectUserHandler.
+func getSessionUser(c *fiber.Ctx) (*entity.Account, entity.User, error) {
+	auth, err := getPrincipal(c)
+	if err != nil {
+		return nil, entity.User{}, err
+	}
+	if auth.UserID == 0 {
+		return nil, entity.User{}, fmt.Errorf("no userID in session")
+	}
+
+	account, err := getSessionAccount(c)
+	if err != nil {
+		return nil, entity.User{}, err
+	}
+
+	user, err := util.BinarySearch(account.Users, entity.User{ID: auth.UserID})
+	return account, user, err
 }
 
 func HelloHandler(c *fiber.Ctx) error {
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/util"
+)
+
+const (
+	defaultImpersonationMinutes = 15
+	maxImpersonationMinutes     = 60
+)
+
+func impersonationAuditEntry(impersonation *entity.Impersonation, action string, details map[string]string) *entity.AuditEntry {
+	return &entity.AuditEntry{
+		ActorAccountID: impersonation.AdminAccountID,
+		Action:         action,
+		SubjectType:    "impersonation",
+		SubjectID:      impersonation.ID,
+		Details:        details,
+	}
+}
+
+// impersonationClosed are the /account/:accountID and /user/self endpoints
+// that stay closed during an impersonation, even with writes allowed, so the
+// admin can't take over or remove the account they view the site as.
+var impersonationClosed = []string{"tokens", "sessions", "identities", "two-factor", "deletion", "export"}
+
+func impersonationCloses(path string) bool {
+	segments := strings.Split(strings.Trim(strings.ToLower(path), "/"), "/")
+	if len(segments) < 3 || (segments[0] != "account" && segments[0] != "user") {
+		return false
+	}
+	return slices.Contains(impersonationClosed, segments[2])
+}
+
+// impersonationAllows reports whether a request may go through during the
+// impersonation. Credentials, sessions and deletion are always closed.
+// Anything else that could change data is blocked unless the admin asked
+// for writes, apart from switching persona and ending the impersonation.
+func impersonationAllows(c *fiber.Ctx, impersonation *entity.Impersonation) bool {
+	if impersonationCloses(c.Path()) {
+		return false
+	}
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	if impersonation.AllowWrites {
+		return true
+	}
+	if c.Method() == fiber.MethodDelete && c.Path() == "/impersonation" {
+		return true
+	}
+	return c.Method() == fiber.MethodPut && strings.HasSuffix(c.Path(), "/select")
+}
+
+// impersonatedRequest runs a request made during an impersonation and
+// audits it, whether or not it was allowed.
+func impersonatedRequest(c *fiber.Ctx, impersonation *entity.Impersonation) error {
+	var err error
+	if impersonationAllows(c, impersonation) {
+		err = c.Next()
+	} else {
+		log.Printf("Blocked %s %s during impersonation %d", c.Method(), c.Path(), impersonation.ID)
+		err = c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "blocked while impersonating",
+		})
+	}
+
+	status := c.Response().StatusCode()
+	if err != nil {
+		status = fiber.StatusInternalServerError
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			status = fiberErr.Code
+		}
+	}
+	entry := impersonationAuditEntry(impersonation, "impersonation.request", map[string]string{
+		"method": c.Method(),
+		"path":   c.OriginalURL(),
+		"status": fmt.Sprint(status),
+	})
+	if err := db.AddAuditEntry(entry); err != nil {
+		log.Printf("Failed to audit impersonated request: %s", err)
+	}
+	return err
+}
+
+// endImpersonation puts the admin back in the session.
+func endImpersonation(sess *session.Session, impersonation *entity.Impersonation, reason string) error {
+	sess.Set("accountID", impersonation.AdminAccountID)
+	sess.Set("userID", impersonation.AdminUserID)
+	sess.Set("userRole", entity.RoleAdmin)
+	sess.Delete("impersonationID")
+	if err := sess.Save(); err != nil {
+		return err
+	}
+
+	entry := impersonationAuditEntry(impersonation, "impersonation.end", map[string]string{
+		"reason": reason,
+	})
+	return db.EndImpersonation(impersonation, time.Now(), entry)
+}
+
+// StartImpersonationHandler switches the admin's session to the target
+// account and persona until it expires or is ended.
+func StartImpersonationHandler(c *fiber.Ctx) error {
+	principal, err := getPrincipal(c)
+	if err != nil || principal.Token {
+		log.Printf("Impersonation needs a cookie session in StartImpersonationHandler: %v", err)
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	account, status := getTargetAccount(c)
+	if status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+	if account.ID == principal.AccountID {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	// Impersonating staff would hand out their powers
+	if _, err := db.GetStaffGrant(account.ID); err == nil {
+		log.Printf("Refusing to impersonate staff account %d", account.ID)
+		return c.SendStatus(fiber.StatusForbidden)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Failed to get staff grant in StartImpersonationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	reqBody := struct {
+		UserID      uint   `json:"user_id"`
+		Reason      string `json:"reason"`
+		Minutes     int    `json:"minutes"`
+		AllowWrites bool   `json:"allow_writes"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in StartImpersonationHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	reqBody.Reason = strings.TrimSpace(reqBody.Reason)
+	if reqBody.Reason == "" {
+		log.Println("Missing reason in StartImpersonationHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if reqBody.Minutes == 0 {
+		reqBody.Minutes = defaultImpersonationMinutes
+	}
+	if reqBody.Minutes < 1 || reqBody.Minutes > maxImpersonationMinutes {
+		log.Printf("Invalid duration %d in StartImpersonationHandler", reqBody.Minutes)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if reqBody.UserID == 0 && len(account.Users) > 0 {
+		reqBody.UserID = account.Users[0].ID
+	}
+	user, err := util.BinarySearch(account.Users, entity.User{ID: reqBody.UserID})
+	if err != nil {
+		log.Printf("User %d is not on account %d in StartImpersonationHandler", reqBody.UserID, account.ID)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	impersonation := &entity.Impersonation{
+		AdminAccountID: principal.AccountID,
+		AdminUserID:    principal.UserID,
+		AccountID:      account.ID,
+		UserID:         user.ID,
+		Reason:         reqBody.Reason,
+		AllowWrites:    reqBody.AllowWrites,
+		ExpiresAt:      time.Now().Add(time.Duration(reqBody.Minutes) * time.Minute),
+	}
+	entry := impersonationAuditEntry(impersonation, "impersonation.start", map[string]string{
+		"account_id":   fmt.Sprint(account.ID),
+		"user_id":      fmt.Sprint(user.ID),
+		"reason":       impersonation.Reason,
+		"allow_writes": fmt.Sprint(impersonation.AllowWrites),
+		"expires_at":   impersonation.ExpiresAt.Format(time.RFC3339),
+	})
+	if err := db.AddImpersonation(impersonation, entry); err != nil {
+		log.Printf("Failed to add impersonation in StartImpersonationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		log.Printf("Failed to get session in StartImpersonationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	sess.Set("accountID", account.ID)
+	sess.Set("userID", user.ID)
+	sess.Set("userRole", user.Role)
+	sess.Set("impersonationID", impersonation.ID)
+	if err := sess.Save(); err != nil {
+		log.Printf("Failed to save session in StartImpersonationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(impersonation)
+}
+
+func EndImpersonationHandler(c *fiber.Ctx) error {
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		log.Printf("Failed to get session in EndImpersonationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	impersonationID, ok := sess.Get("impersonationID").(uint)
+	if !ok {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	impersonation, err := db.GetImpersonation(impersonationID)
+	if err != nil {
+		log.Printf("Failed to get impersonation in EndImpersonationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if err := endImpersonation(sess, impersonation, "ended"); err != nil {
+		log.Printf("Failed to end impersonation in EndImpersonationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func GetImpersonationsHandler(c *fiber.Ctx) error {
+	impersonations, err := db.GetImpersonations(c.QueryInt("limit", 50))
+	if err != nil {
+		log.Printf("Failed to get impersonations in GetImpersonationsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"impersonations": impersonations,
+	})
+}
@@ -0,0 +1,381 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/authz"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/gateway/mail"
+)
+
+func memberResponse(member *entity.OrganizationMember) fiber.Map {
+	return fiber.Map{
+		"id":              member.ID,
+		"organization_id": member.OrganizationID,
+		"account_id":      member.AccountID,
+		"first_name":      member.Account.FirstName,
+		"last_name":       member.Account.LastName,
+		"email":           member.Account.Email,
+		"role":            member.Role,
+		"status":          member.Status,
+		"created_at":      member.CreatedAt,
+	}
+}
+
+func sendInviteEmail(account *entity.Account, organization *entity.User, role entity.MemberRole) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	link := fmt.Sprintf("%s/organizations/%d", siteURL, organization.ID)
+	err := mailTransport.Send(ctx, &mail.Message{
+		To:      account.Email,
+		Subject: fmt.Sprintf("You have been invited to %s on Toro Space", organization.DisplayName),
+		Text: fmt.Sprintf("Hi %s,\n\nYou have been invited to join %s as %s on Toro Space.\nSign in to accept: %s\n",
+			account.FirstName, organization.DisplayName, role, link),
+	})
+	if err != nil {
+		log.Printf("Failed to send invite email to account %d: %s", account.ID, err)
+	}
+}
+
+// wouldRemoveLastOwner reports whether changing member away from an active
+// owner would leave the organization without one.
+func wouldRemoveLastOwner(member *entity.OrganizationMember) (bool, error) {
+	if member.Role != entity.MemberRoleOwner || member.Status != entity.MemberStatusActive {
+		return false, nil
+	}
+	owners, err := db.CountOrganizationOwners(member.OrganizationID)
+	if err != nil {
+		return false, err
+	}
+	return owners <= 1, nil
+}
+
+func GetOrganizationMembersHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	members, err := db.GetOrganizationMembers(organizationID)
+	if err != nil {
+		log.Printf("Failed to get members in GetOrganizationMembersHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	memberStatus := entity.MemberStatus(c.Query("status"))
+	membersResult := make([]fiber.Map, 0, len(members))
+	for _, member := range members {
+		if memberStatus != "" && member.Status != memberStatus {
+			continue
+		}
+		membersResult = append(membersResult, memberResponse(member))
+	}
+	return c.JSON(fiber.Map{
+		"members": membersResult,
+		"count":   len(membersResult),
+	})
+}
+
+func InviteOrganizationMemberHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in InviteOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	reqBody := struct {
+		Email string            `json:"email"`
+		Role  entity.MemberRole `json:"role"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in InviteOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if !reqBody.Role.IsValid() {
+		log.Printf("Invalid role %q in InviteOrganizationMemberHandler", reqBody.Role)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	organization, err := db.GetOrganization(organizationID)
+	if err != nil || organization.Role != entity.RoleOrganization {
+		log.Println("Failed to get organization in InviteOrganizationMemberHandler")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	invitee, err := db.GetAccountByEmail(strings.TrimSpace(reqBody.Email))
+	if err != nil {
+		log.Printf("No account for %q in InviteOrganizationMemberHandler", reqBody.Email)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if _, err := db.GetOrganizationMember(organizationID, invitee.ID); err == nil {
+		log.Printf("Account %d is already a member of %d in InviteOrganizationMemberHandler", invitee.ID, organizationID)
+		return c.SendStatus(fiber.StatusConflict)
+	}
+
+	member := &entity.OrganizationMember{
+		OrganizationID:     organizationID,
+		AccountID:          invitee.ID,
+		Account:            *invitee,
+		Role:               reqBody.Role,
+		Status:             entity.MemberStatusInvited,
+		InvitedByAccountID: account.ID,
+	}
+	if err := db.AddOrganizationMember(member); err != nil {
+		log.Printf("Failed to add member in InviteOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	sendInviteEmail(invitee, organization, member.Role)
+	return c.Status(fiber.StatusCreated).JSON(memberResponse(member))
+}
+
+func AcceptOrganizationInviteHandler(c *fiber.Ctx) error {
+	organizationID, err := c.ParamsInt("organizationID", -1)
+	if err != nil || organizationID < 1 {
+		log.Println("Failed to get organizationID from params in AcceptOrganizationInviteHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in AcceptOrganizationInviteHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	member, err := db.GetOrganizationMember(uint(organizationID), account.ID)
+	if err != nil || member.Status != entity.MemberStatusInvited {
+		log.Printf("No pending invite for account %d in AcceptOrganizationInviteHandler", account.ID)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	member.Status = entity.MemberStatusActive
+	if err := db.SaveOrganizationMember(member); err != nil {
+		log.Printf("Failed to save member in AcceptOrganizationInviteHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(memberResponse(member))
+}
+
+func UpdateOrganizationMemberHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	memberAccountID, err := c.ParamsInt("memberAccountID", -1)
+	if err != nil || memberAccountID < 1 {
+		log.Println("Failed to get memberAccountID from params in UpdateOrganizationMemberHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	reqBody := struct {
+		Role entity.MemberRole `json:"role"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil || !reqBody.Role.IsValid() {
+		log.Println("Invalid request body in UpdateOrganizationMemberHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	member, err := db.GetOrganizationMember(organizationID, uint(memberAccountID))
+	if err != nil {
+		log.Printf("Failed to get member in UpdateOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if reqBody.Role != entity.MemberRoleOwner {
+		lastOwner, err := wouldRemoveLastOwner(member)
+		if err != nil {
+			log.Printf("Failed to count owners in UpdateOrganizationMemberHandler: %s", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if lastOwner {
+			log.Println("Cannot demote the last owner in UpdateOrganizationMemberHandler")
+			return c.SendStatus(fiber.StatusConflict)
+		}
+	}
+
+	member.Role = reqBody.Role
+	if err := db.SaveOrganizationMember(member); err != nil {
+		log.Printf("Failed to save member in UpdateOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(memberResponse(member))
+}
+
+// RemoveOrganizationMemberHandler lets owners remove anyone, officers remove
+// plain members and deny join requests, and any account leave an
+// organization or decline an invite by removing itself.
+func RemoveOrganizationMemberHandler(c *fiber.Ctx) error {
+	organizationID, err := c.ParamsInt("organizationID", -1)
+	if err != nil || organizationID < 1 {
+		log.Println("Failed to get organizationID from params in RemoveOrganizationMemberHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	memberAccountID, err := c.ParamsInt("memberAccountID", -1)
+	if err != nil || memberAccountID < 1 {
+		log.Println("Failed to get memberAccountID from params in RemoveOrganizationMemberHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in RemoveOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	member, err := db.GetOrganizationMember(uint(organizationID), uint(memberAccountID))
+	if err != nil {
+		log.Printf("Failed to get member in RemoveOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if account.ID != uint(memberAccountID) {
+		action := authz.AssignMembers
+		if member.Role == entity.MemberRoleMember {
+			action = authz.ManageMembers
+		}
+		if status := authorize(c, action); status != fiber.StatusOK {
+			return c.SendStatus(status)
+		}
+	}
+
+	lastOwner, err := wouldRemoveLastOwner(member)
+	if err != nil {
+		log.Printf("Failed to count owners in RemoveOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if lastOwner {
+		log.Println("Cannot remove the last owner in RemoveOrganizationMemberHandler")
+		return c.SendStatus(fiber.StatusConflict)
+	}
+
+	if err := db.RemoveOrganizationMember(member); err != nil {
+		log.Printf("Failed to remove member in RemoveOrganizationMemberHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// JoinOrganizationHandler adds the session account as a member right away for
+// open organizations and files a join request for those requiring approval.
+func JoinOrganizationHandler(c *fiber.Ctx) error {
+	organizationID, err := c.ParamsInt("organizationID", -1)
+	if err != nil || organizationID < 1 {
+		log.Println("Failed to get organizationID from params in JoinOrganizationHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in JoinOrganizationHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	organization, err := db.GetOrganization(uint(organizationID))
+	if err != nil || organization.Role != entity.RoleOrganization {
+		log.Println("Failed to get organization in JoinOrganizationHandler")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if _, err := db.GetOrganizationMember(organization.ID, account.ID); err == nil {
+		log.Printf("Account %d is already a member of %d in JoinOrganizationHandler", account.ID, organization.ID)
+		return c.SendStatus(fiber.StatusConflict)
+	}
+
+	member := &entity.OrganizationMember{
+		OrganizationID: organization.ID,
+		AccountID:      account.ID,
+		Account:        *account,
+		Role:           entity.MemberRoleMember,
+	}
+	switch organization.Profile.EffectiveJoinPolicy() {
+	case entity.JoinPolicyOpen:
+		member.Status = entity.MemberStatusActive
+	case entity.JoinPolicyApproval:
+		member.Status = entity.MemberStatusRequested
+	default:
+		log.Printf("Organization %d is invite only in JoinOrganizationHandler", organization.ID)
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if err := db.AddOrganizationMember(member); err != nil {
+		log.Printf("Failed to add member in JoinOrganizationHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(memberResponse(member))
+}
+
+func ApproveJoinRequestHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in ApproveJoinRequestHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	memberAccountID, err := c.ParamsInt("memberAccountID", -1)
+	if err != nil || memberAccountID < 1 {
+		log.Println("Failed to get memberAccountID from params in ApproveJoinRequestHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	member, err := db.GetOrganizationMember(organizationID, uint(memberAccountID))
+	if err != nil || member.Status != entity.MemberStatusRequested {
+		log.Printf("No join request from account %d in ApproveJoinRequestHandler", memberAccountID)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	member.Status = entity.MemberStatusActive
+	member.InvitedByAccountID = account.ID
+	if err := db.SaveOrganizationMember(member); err != nil {
+		log.Printf("Failed to save member in ApproveJoinRequestHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(memberResponse(member))
+}
+
+// ExportOrganizationMembersHandler writes the active roster as CSV, e.g. for
+// event sign-in sheets.
+func ExportOrganizationMembersHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	members, err := db.GetOrganizationMembers(organizationID)
+	if err != nil {
+		log.Printf("Failed to get members in ExportOrganizationMembersHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	rows := [][]string{{"first_name", "last_name", "email", "role", "joined_at"}}
+	for _, member := range members {
+		if member.Status != entity.MemberStatusActive {
+			continue
+		}
+		rows = append(rows, []string{
+			member.Account.FirstName,
+			member.Account.LastName,
+			member.Account.Email,
+			string(member.Role),
+			member.CreatedAt.Format(time.DateOnly),
+		})
+	}
+	return sendCSV(c, fmt.Sprintf("organization-%d-members.csv", organizationID), rows)
+}
+
+func GetInvitationsHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetInvitationsHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	invitations, err := db.GetAccountMemberships(account.ID, entity.MemberStatusInvited)
+	if err != nil {
+		log.Printf("Failed to get invitations in GetInvitationsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"invitations": invitations,
+	})
+}
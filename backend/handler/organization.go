@@ -1,16 +1,39 @@
 package handler
 
 import (
+	"log"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
 	"torospace.csudh.edu/api/sqlite"
 )
 
+// isOrganizationOfficer reports whether the account is an active owner or
+// officer of the organization, and so may post and moderate as it.
+func isOrganizationOfficer(accountID uint, organizationID uint) bool {
+	member, err := db.GetOrganizationMember(organizationID, accountID)
+	if err != nil {
+		return false
+	}
+	return member.Status == entity.MemberStatusActive && member.Role.CanActAsOrganization()
+}
+
 func GetOrganizationsHandler(c *fiber.Ctx) error {
 	organizationParams := &sqlite.OrganizationParams{
-		Before:      c.Query("before", ""),
-		After:       c.Query("after", ""),
-		PageSize:    c.QueryInt("page_size", 10),
-		SearchQuery: c.Query("search_query", ""),
+		Before:           c.Query("before", ""),
+		After:            c.Query("after", ""),
+		Page:             c.QueryInt("page", 1),
+		PageSize:         c.QueryInt("page_size", 10),
+		SearchQuery:      c.Query("search_query", ""),
+		Category:         c.Query("category", ""),
+		MinMembers:       c.QueryInt("min_members", 0),
+		ActiveWithinDays: c.QueryInt("active_within_days", 0),
+		Sort:             sqlite.OrganizationSort(c.Query("sort", "")),
+	}
+	if verified := c.Query("verified"); verified != "" {
+		value := c.QueryBool("verified")
+		organizationParams.Verified = &value
 	}
 	organizationsResult, err := db.GetOrganizations(organizationParams)
 	if err != nil {
@@ -30,3 +53,53 @@ func GetOrganizationHandler(c *fiber.Ctx) error {
 	}
 	return c.JSON(organization)
 }
+
+func UpdateOrganizationProfileHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	organization, err := db.GetOrganization(organizationID)
+	if err != nil || organization.Role != entity.RoleOrganization {
+		log.Println("Failed to get organization in UpdateOrganizationProfileHandler")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	profile := &entity.OrganizationProfile{}
+	if err := c.BodyParser(profile); err != nil {
+		log.Printf("Failed to parse request body in UpdateOrganizationProfileHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	profile.Description = strings.TrimSpace(profile.Description)
+	profile.Category = strings.ToLower(strings.TrimSpace(profile.Category))
+	if profile.Category != "" {
+		if _, err := db.GetCategory(profile.Category); err != nil {
+			log.Printf("Unknown category %q in UpdateOrganizationProfileHandler", profile.Category)
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "category must be one of the directory categories",
+			})
+		}
+	}
+	profile.MeetingSchedule = strings.TrimSpace(profile.MeetingSchedule)
+	profile.ContactEmail = strings.TrimSpace(profile.ContactEmail)
+	profile.BannerUrl = strings.TrimSpace(profile.BannerUrl)
+	if profile.JoinPolicy == "" {
+		profile.JoinPolicy = organization.Profile.EffectiveJoinPolicy()
+	}
+	if profile.SocialLinks == nil {
+		profile.SocialLinks = []entity.SocialLink{}
+	}
+
+	if err := profile.Validate(); err != nil {
+		log.Printf("Invalid profile in UpdateOrganizationProfileHandler: %s", err)
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if err := db.SaveOrganizationProfile(organizationID, profile); err != nil {
+		log.Printf("Failed to save profile in UpdateOrganizationProfileHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	organization.Profile = profile
+	return c.JSON(organization)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"log"
+	"slices"
 	"strings"
 	"time"
 
@@ -10,28 +11,35 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/event"
 	pb "torospace.csudh.edu/api/proto/spam_detector"
 	"torospace.csudh.edu/api/sqlite"
-	"torospace.csudh.edu/api/util"
 )
 
-func GetPostsHandler(c *fiber.Ctx) error {
-	sess, err := sessionStore.Get(c)
+// postAudience describes the reader behind the session for post visibility.
+func postAudience(c *fiber.Ctx) sqlite.PostAudience {
+	auth, err := getPrincipal(c)
 	if err != nil {
-		sess = nil
+		return sqlite.PostAudience{}
+	}
+	return sqlite.PostAudience{
+		AccountID: auth.AccountID,
+		Admin:     auth.Role == entity.RoleAdmin,
 	}
+}
 
-	var userRole any
-	var ok bool
-	if sess != nil {
-		userRole, ok = sess.Get("userRole").(entity.Role)
+func GetPostsHandler(c *fiber.Ctx) error {
+	var userRole entity.Role
+	if auth, err := getPrincipal(c); err == nil {
+		userRole = auth.Role
 	}
 	postParams := &sqlite.PostParams{
 		Before:      c.Query("before", ""),
 		After:       c.Query("after", ""),
 		PageSize:    c.QueryInt("page_size", 10),
 		SearchQuery: c.Query("search_query", ""),
-		GetHidden:   sess != nil && ((ok && userRole == entity.RoleAdmin) || (userRole == entity.RoleOrganization)),
+		GetHidden:   userRole == entity.RoleAdmin || userRole == entity.RoleModerator || userRole == entity.RoleOrganization,
+		Audience:    postAudience(c),
 	}
 
 	postsResult, err := db.GetPosts(postParams)
@@ -42,32 +50,25 @@ func GetPostsHandler(c *fiber.Ctx) error {
 }
 
 func GetPostsByOrganizationHandler(c *fiber.Ctx) error {
-	sess, err := sessionStore.Get(c)
-	if err != nil {
-		sess = nil
-	}
-
 	organizationID, err := c.ParamsInt("organizationID")
 	if err != nil {
 		log.Println("Failed to get organizationID from params in GetPostsByOrganizationHandler")
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
-	var userRole any
-	var user *entity.User
-	var ok bool
-	if sess != nil {
-		userRole, ok = sess.Get("userRole").(entity.Role)
-		if ok {
-			user, ok = sess.Get("userID").(*entity.User)
-		}
+	var userRole entity.Role
+	var userID uint
+	if auth, err := getPrincipal(c); err == nil {
+		userRole = auth.Role
+		userID = auth.UserID
 	}
 	postParams := &sqlite.PostParams{
 		Before:      c.Query("before", ""),
 		After:       c.Query("after", ""),
 		PageSize:    c.QueryInt("page_size", 10),
 		SearchQuery: c.Query("search_query", ""),
-		GetHidden:   sess != nil && ((ok && userRole == entity.RoleAdmin) || (user.ID == uint(organizationID))),
+		GetHidden:   userRole == entity.RoleAdmin || userRole == entity.RoleModerator || (userID != 0 && userID == uint(organizationID)),
+		Audience:    postAudience(c),
 	}
 
 	postsResult, err := db.GetPostsByOrganization(uint(organizationID), postParams)
@@ -89,146 +90,44 @@ func GetPostHandler(c *fiber.Ctx) error {
 		log.Println("Failed to get post by ID in GetPostHandler")
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
+	if !db.CanViewPost(postAudience(c), post) {
+		log.Printf("Post %d is not visible to the reader in GetPostHandler", post.ID)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if !post.Hidden {
+		recordView(c, post.ID, time.Now())
+	}
 	return c.JSON(post)
 }
 
 func DeletePostHandler(c *fiber.Ctx) error {
-	sess, err := sessionStore.Get(c)
-	if err != nil {
-		log.Println("Failed to get session store in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sessAccountID, ok := sess.Get("accountID").(uint)
-	if !ok {
-		log.Println("Failed to get accountID in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sessUserID, ok := sess.Get("userID").(uint)
-	if !ok {
-		log.Println("Failed to get userID in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	account, err := db.GetAccountByID(sessAccountID)
-	if err != nil {
-		log.Println("Failed to get account by ID in CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	user, err := util.BinarySearch(account.Users, entity.User{ID: sessUserID})
-	if err != nil {
-		log.Println("Failed to get user by ID in CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	if user.Role != entity.RoleAdmin && user.Role != entity.RoleOrganization {
-		log.Println("User is not an admin or organization in CreatePostHandler (from DB)")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sess.SetExpiry(30 * time.Minute)
-	if err := sess.Save(); err != nil {
-		log.Println("Failed to save sesion store in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	postID, err := c.ParamsInt("postID")
-	if err != nil {
-		log.Println("Failed to get postID from params in DeletePostHandler")
-		return c.SendStatus(fiber.StatusBadRequest)
-	}
-
-	post, err := db.GetPost(uint(postID))
-	if err != nil {
-		log.Println("Failed to get post by ID in DeletePostHandler")
-		return c.SendStatus(fiber.StatusInternalServerError)
-	}
-
-	if user.Role != entity.RoleAdmin && post.Author.ID != sessUserID {
-		log.Println("User is not the author of the post in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	if err := db.DeletePost(uint(postID)); err != nil {
+	post := authorizedPost(c)
+	if err := db.DeletePost(post.ID); err != nil {
 		log.Println("Failed to delete post in DeletePostHandler")
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
+	publishPostEvent(event.TypePostDeleted, post)
 
 	return c.SendStatus(fiber.StatusOK)
 }
 
 func HidePostHandler(c *fiber.Ctx) error {
-	sess, err := sessionStore.Get(c)
-	if err != nil {
-		log.Println("Failed to get session store in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sessAccountID, ok := sess.Get("accountID").(uint)
-	if !ok {
-		log.Println("Failed to get accountID in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sessUserID, ok := sess.Get("userID").(uint)
-	if !ok {
-		log.Println("Failed to get userID in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	account, err := db.GetAccountByID(sessAccountID)
-	if err != nil {
-		log.Println("Failed to get account by ID in CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	user, err := util.BinarySearch(account.Users, entity.User{ID: sessUserID})
-	if err != nil {
-		log.Println("Failed to get user by ID in CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	if user.Role != entity.RoleAdmin && user.Role != entity.RoleOrganization {
-		log.Println("User is not an admin or organization in CreatePostHandler (from DB)")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sess.SetExpiry(30 * time.Minute)
-	if err := sess.Save(); err != nil {
-		log.Println("Failed to save sesion store in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	postID, err := c.ParamsInt("postID")
-	if err != nil {
-		log.Println("Failed to get postID from params in DeletePostHandler")
-		return c.SendStatus(fiber.StatusBadRequest)
-	}
-
-	post, err := db.GetPost(uint(postID))
-	if err != nil {
-		log.Println("Failed to get post by ID in DeletePostHandler")
-		return c.SendStatus(fiber.StatusInternalServerError)
-	}
-
-	if user.Role != entity.RoleAdmin && post.Author.ID != sessUserID {
-		log.Println("User is not the author of the post in DeletePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
+	post := authorizedPost(c)
 
 	action := c.Query("action", "hide")
 	if action == "hide" {
-		if err := db.HidePost(uint(postID)); err != nil {
-			log.Println("Failed to delete post in DeletePostHandler")
+		if err := db.HidePost(post.ID); err != nil {
+			log.Println("Failed to hide post in HidePostHandler")
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
+		publishPostEvent(event.TypePostHidden, post)
 	} else if action == "unhide" {
-		if err := db.UnhidePost(uint(postID)); err != nil {
-			log.Println("Failed to delete post in DeletePostHandler")
+		if err := db.UnhidePost(post.ID); err != nil {
+			log.Println("Failed to unhide post in HidePostHandler")
 			return c.SendStatus(fiber.StatusInternalServerError)
 		}
+		post.Hidden = false
+		publishPostEvent(event.TypePostUnhidden, post)
 	} else {
 		log.Println("Invalid action in HidePostHandler")
 		return c.SendStatus(fiber.StatusBadRequest)
@@ -241,21 +140,9 @@ func LikePostHandler(c *fiber.Ctx) error {
 
 	like := c.Query("type", "like")
 
-	sess, err := sessionStore.Get(c)
+	_, user, err := getSessionUser(c)
 	if err != nil {
-		log.Println("Failed to get session store in LikePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sessAccountID, ok := sess.Get("accountID").(uint)
-	if !ok {
-		log.Println("Failed to get accountID in LikePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sessUserID, ok := sess.Get("userID").(uint)
-	if !ok {
-		log.Println("Failed to get userID in LikePostHandler")
+		log.Printf("Failed to get session user in LikePostHandler: %s", err)
 		return c.SendStatus(fiber.StatusForbidden)
 	}
 
@@ -265,16 +152,9 @@ func LikePostHandler(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
-	account, err := db.GetAccountByID(sessAccountID)
-	if err != nil {
-		log.Println("Failed to get account by ID in LikePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	user, err := util.BinarySearch(account.Users, entity.User{ID: sessUserID})
-	if err != nil {
-		log.Println("Failed to get user by ID in LikePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
+	if post, err := db.GetPost(uint(postID)); err != nil || !db.CanViewPost(postAudience(c), post) {
+		log.Println("Post is not visible to the reader in LikePostHandler")
+		return c.SendStatus(fiber.StatusNotFound)
 	}
 
 	if like == "like" {
@@ -299,54 +179,27 @@ func LikePostHandler(c *fiber.Ctx) error {
 		log.Println("Failed to get post by ID in LikePostHandler")
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
+	if !post.Hidden {
+		publishPostEvent(event.TypePostLiked, post)
+	}
 
 	return c.Status(fiber.StatusOK).JSON(post)
 }
 
 func CreatePostHandler(c *fiber.Ctx) error {
-	sess, err := sessionStore.Get(c)
+	account, user, err := getSessionUser(c)
 	if err != nil {
-		log.Println("Failed to get session store in CreatePostHandler")
+		log.Printf("Failed to get session user in CreatePostHandler: %s", err)
 		return c.SendStatus(fiber.StatusForbidden)
 	}
 
-	sessAccountID, ok := sess.Get("accountID").(uint)
-	if !ok {
-		log.Println("Failed to get accountID in CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	accountID, err := c.ParamsInt("accountID")
-	if err != nil {
-		if c.Params("accountID") != "self" {
-			log.Println("Failed to get accountID from params")
-			return c.SendStatus(fiber.StatusBadRequest)
-		}
-	} else if uint(accountID) != sessAccountID {
-		log.Printf("Failed to get accountID from session")
-		return c.SendStatus(fiber.StatusUnauthorized)
-	}
-
 	userID, err := c.ParamsInt("userID")
 	if err != nil {
 		log.Println("Failed to get userID from params in CreatePostHandler")
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
-
-	sessUserID, ok := sess.Get("userID").(uint)
-	if !ok || uint(userID) != sessUserID {
-		log.Println("No userID in session for CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	if role, ok := sess.Get("userRole").(entity.Role); !ok || (role != entity.RoleAdmin && role != entity.RoleOrganization) {
-		log.Println("User is not an admin or organization in CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	sess.SetExpiry(30 * time.Minute)
-	if err := sess.Save(); err != nil {
-		log.Println("Failed to save sesion store in CreatePostHandler")
+	if uint(userID) != user.ID {
+		log.Println("userID does not match the session in CreatePostHandler")
 		return c.SendStatus(fiber.StatusForbidden)
 	}
 
@@ -356,23 +209,6 @@ func CreatePostHandler(c *fiber.Ctx) error {
 		return c.SendStatus(fiber.StatusBadRequest)
 	}
 
-	account, err := db.GetAccountByID(sessAccountID)
-	if err != nil {
-		log.Println("Failed to get account by ID in CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	user, err := util.BinarySearch(account.Users, entity.User{ID: sessUserID})
-	if err != nil {
-		log.Println("Failed to get user by ID in CreatePostHandler")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
-	if user.Role != entity.RoleAdmin && user.Role != entity.RoleOrganization {
-		log.Println("User is not an admin or organization in CreatePostHandler (from DB)")
-		return c.SendStatus(fiber.StatusForbidden)
-	}
-
 	postContent, ok := reqBody["content"].(string)
 	if !ok || len(postContent) < 1 {
 		log.Printf("Failed to get content from request body in CreatePostHandler: %v is %T", reqBody["content"], reqBody["content"])
@@ -381,8 +217,9 @@ func CreatePostHandler(c *fiber.Ctx) error {
 	postContent = strings.TrimSpace(postContent)
 
 	post := &entity.Post{
-		Content: postContent,
-		Author:  user,
+		Content:   postContent,
+		Author:    user,
+		Coauthors: []entity.PostCoauthor{},
 	}
 
 	reqTopics, ok := reqBody["topics"].([]interface{})
@@ -405,9 +242,50 @@ func CreatePostHandler(c *fiber.Ctx) error {
 		log.Println("Failed to get topics from request body in CreatePostHandler, ignoring...")
 	}
 
+	post.Visibility = entity.VisibilityPublic
+	if visibility, ok := reqBody["visibility"].(string); ok && visibility != "" {
+		post.Visibility = entity.Visibility(visibility)
+		if !post.Visibility.IsValid() {
+			log.Printf("Invalid visibility %q in CreatePostHandler", visibility)
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+	}
+
+	// Co-authors are checked before the post exists so a bad invite
+	// doesn't leave a post behind without it.
+	coauthorIDs := []uint{}
+	if reqCoauthors, ok := reqBody["coauthors"].([]interface{}); ok {
+		for _, organizationID := range reqCoauthors {
+			organizationID, ok := organizationID.(float64)
+			if !ok || organizationID < 1 || organizationID != float64(uint(organizationID)) {
+				log.Printf("Invalid co-author in CreatePostHandler: %v", organizationID)
+				return c.SendStatus(fiber.StatusBadRequest)
+			}
+			if slices.Contains(coauthorIDs, uint(organizationID)) {
+				log.Printf("Duplicate co-author %d in CreatePostHandler", uint(organizationID))
+				return c.SendStatus(fiber.StatusBadRequest)
+			}
+			if _, status := getCoauthorOrganization(user.ID, uint(organizationID)); status != fiber.StatusOK {
+				return c.Status(status).JSON(fiber.Map{
+					"error":           "invalid co-author",
+					"organization_id": uint(organizationID),
+				})
+			}
+			coauthorIDs = append(coauthorIDs, uint(organizationID))
+		}
+	}
+
 	if err := db.AddPost(post); err != nil {
 		return c.SendStatus(fiber.StatusInternalServerError)
 	}
+	for _, organizationID := range coauthorIDs {
+		coauthor, status := invitePostCoauthor(account, post, organizationID)
+		if status != fiber.StatusCreated {
+			log.Printf("Failed to invite co-author %d to post %d in CreatePostHandler", organizationID, post.ID)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		post.Coauthors = append(post.Coauthors, *coauthor)
+	}
 
 	conn, err := grpc.NewClient("127.0.0.1:3060", grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err == nil {
@@ -419,6 +297,7 @@ func CreatePostHandler(c *fiber.Ctx) error {
 				if err := db.HidePost(post.ID); err != nil {
 					return c.SendStatus(fiber.StatusInternalServerError)
 				}
+				post.Hidden = true
 			}
 		}
 		conn.Close()
@@ -426,5 +305,9 @@ func CreatePostHandler(c *fiber.Ctx) error {
 		log.Printf("Failed to connect to grpc: %v", err)
 	}
 
+	if !post.Hidden {
+		publishPostEvent(event.TypePostCreated, post)
+	}
+
 	return c.JSON(post)
 }
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/sqlite"
+)
+
+// StartSessionCleanupJob deletes expired sessions every hour.
+func StartSessionCleanupJob(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for {
+			if _, err := db.DeleteExpiredSessions(); err != nil {
+				log.Printf("Failed to delete expired sessions: %s", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// currentSessionKeyHash identifies the caller's session in the sessions table.
+func currentSessionKeyHash(c *fiber.Ctx) (string, error) {
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		return "", err
+	}
+	return sqlite.SessionKeyHash(sess.ID()), nil
+}
+
+func GetSessionsHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetSessionsHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	current, err := currentSessionKeyHash(c)
+	if err != nil {
+		log.Printf("Failed to get session in GetSessionsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	sessions, err := db.GetAccountSessions(account.ID)
+	if err != nil {
+		log.Printf("Failed to get sessions in GetSessionsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	for _, session := range sessions {
+		session.Current = session.KeyHash == current
+	}
+	return c.JSON(fiber.Map{
+		"sessions": sessions,
+	})
+}
+
+func RevokeSessionHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in RevokeSessionHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	sessionID, err := c.ParamsInt("sessionID", -1)
+	if err != nil || sessionID < 1 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	revoked, err := db.DeleteAccountSession(account.ID, uint(sessionID))
+	if err != nil {
+		log.Printf("Failed to revoke session in RevokeSessionHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if revoked == 0 {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// RevokeSessionsHandler logs the account out everywhere but the current
+// session.
+func RevokeSessionsHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in RevokeSessionsHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	current, err := currentSessionKeyHash(c)
+	if err != nil {
+		log.Printf("Failed to get session in RevokeSessionsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	revoked, err := db.DeleteAccountSessions(account.ID, current)
+	if err != nil {
+		log.Printf("Failed to revoke sessions in RevokeSessionsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"revoked": revoked,
+	})
+}
+
+// ForceLogoutAccountHandler lets an admin end every session of an account.
+func ForceLogoutAccountHandler(c *fiber.Ctx) error {
+	admin, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in ForceLogoutAccountHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	// Not :accountID, which getSessionAccount matches against the caller
+	accountID, err := c.ParamsInt("targetAccountID", -1)
+	if err != nil || accountID < 1 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if _, err := db.GetAccountByID(uint(accountID)); err != nil {
+		log.Printf("Failed to get account in ForceLogoutAccountHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	revoked, err := db.DeleteAccountSessions(uint(accountID), "")
+	if err != nil {
+		log.Printf("Failed to revoke sessions in ForceLogoutAccountHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	err = db.AddAuditEntry(&entity.AuditEntry{
+		ActorAccountID: admin.ID,
+		Action:         "account.force_logout",
+		SubjectType:    "account",
+		SubjectID:      uint(accountID),
+		Details: map[string]string{
+			"revoked": fmt.Sprint(revoked),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to audit force logout in ForceLogoutAccountHandler: %s", err)
+	}
+	return c.JSON(fiber.Map{
+		"revoked": revoked,
+	})
+}
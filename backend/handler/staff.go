@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/sqlite"
+)
+
+func getTargetAccount(c *fiber.Ctx) (*entity.Account, int) {
+	// Not :accountID, which getSessionAccount matches against the caller
+	accountID, err := c.ParamsInt("targetAccountID", -1)
+	if err != nil || accountID < 1 {
+		return nil, fiber.StatusBadRequest
+	}
+	account, err := db.GetAccountByID(uint(accountID))
+	if err != nil {
+		log.Printf("Failed to get account %d: %s", accountID, err)
+		return nil, fiber.StatusNotFound
+	}
+	return account, fiber.StatusOK
+}
+
+func GetStaffHandler(c *fiber.Ctx) error {
+	grants, err := db.GetStaffGrants()
+	if err != nil {
+		log.Printf("Failed to get staff in GetStaffHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"staff": grants,
+	})
+}
+
+// SetStaffRoleHandler promotes an account to staff or changes its staff
+// role. The account's sessions see the change on their next request.
+func SetStaffRoleHandler(c *fiber.Ctx) error {
+	principal, err := getPrincipal(c)
+	if err != nil {
+		log.Printf("Failed to get principal in SetStaffRoleHandler: %s", err)
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	account, status := getTargetAccount(c)
+	if status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+
+	reqBody := struct {
+		Role entity.StaffRole `json:"role"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil || !reqBody.Role.IsValid() {
+		log.Printf("Invalid staff role %q in SetStaffRoleHandler", reqBody.Role)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	previous := ""
+	if grant, err := db.GetStaffGrant(account.ID); err == nil {
+		previous = string(grant.Role)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Failed to get staff grant in SetStaffRoleHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	entry := &entity.AuditEntry{
+		ActorAccountID: principal.AccountID,
+		Action:         "staff.set_role",
+		SubjectType:    "account",
+		Details: map[string]string{
+			"role":     string(reqBody.Role),
+			"previous": previous,
+		},
+	}
+	grant, err := db.SetStaffRole(account, reqBody.Role, &principal.AccountID, entry)
+	if errors.Is(err, sqlite.ErrLastSuperAdmin) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	} else if err != nil {
+		log.Printf("Failed to set staff role in SetStaffRoleHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(grant)
+}
+
+// RemoveStaffRoleHandler demotes a staff account back to its other personas.
+func RemoveStaffRoleHandler(c *fiber.Ctx) error {
+	principal, err := getPrincipal(c)
+	if err != nil {
+		log.Printf("Failed to get principal in RemoveStaffRoleHandler: %s", err)
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	account, status := getTargetAccount(c)
+	if status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+	grant, err := db.GetStaffGrant(account.ID)
+	if err != nil {
+		log.Printf("Failed to get staff grant in RemoveStaffRoleHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	entry := &entity.AuditEntry{
+		ActorAccountID: principal.AccountID,
+		Action:         "staff.remove",
+		SubjectType:    "account",
+		SubjectID:      account.ID,
+		Details: map[string]string{
+			"previous": string(grant.Role),
+		},
+	}
+	err = db.RemoveStaffRole(grant, entry)
+	if errors.Is(err, sqlite.ErrLastSuperAdmin) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	} else if err != nil {
+		log.Printf("Failed to remove staff role in RemoveStaffRoleHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/event"
+)
+
+var (
+	eventHub *event.Hub
+)
+
+func init() {
+	eventHub = event.NewHub(64)
+}
+
+func publishPostEvent(eventType event.Type, post *entity.Post) {
+	e := event.NewPostEvent(eventType, post)
+	eventHub.Publish(e)
+	enqueueWebhookEvent(e)
+	federatePostEvent(e)
+}
+
+func StreamHandler(c *fiber.Ctx) error {
+	organizationID := c.QueryInt("organization_id", 0)
+	if organizationID < 0 {
+		log.Println("Invalid organization_id in StreamHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	filter := event.Filter{
+		OrganizationID: uint(organizationID),
+		Topic:          c.Query("topic", ""),
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	sub := eventHub.Subscribe(filter)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer eventHub.Unsubscribe(sub)
+
+		heartbeat := time.NewTicker(15 * time.Second)
+		defer heartbeat.Stop()
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		for {
+			select {
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				// The client fell behind and missed events, ask it to refetch
+				if dropped := sub.TakeDropped(); dropped > 0 {
+					fmt.Fprintf(w, "event: resync\ndata: {\"dropped\":%d}\n\n", dropped)
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					log.Printf("Failed to marshal event in StreamHandler: %s", err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+
+			// Flush fails once the client has gone away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
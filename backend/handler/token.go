@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/util"
+)
+
+const (
+	accessTokenPrefix = "tsp_"
+	// accessTokenTouchInterval limits last_used_at writes for busy tokens
+	accessTokenTouchInterval = time.Minute
+	maxAccessTokenDays       = 365
+)
+
+func newAccessTokenValue() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return accessTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func GetAccessTokensHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetAccessTokensHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	tokens, err := db.GetAccountAccessTokens(account.ID)
+	if err != nil {
+		log.Printf("Failed to get access tokens in GetAccessTokensHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"tokens": tokens,
+	})
+}
+
+// CreateAccessTokenHandler issues a token. The raw value is only ever
+// returned here.
+func CreateAccessTokenHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in CreateAccessTokenHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	reqBody := struct {
+		Name          string              `json:"name"`
+		UserID        uint                `json:"user_id"`
+		Scopes        []entity.TokenScope `json:"scopes"`
+		ExpiresInDays int                 `json:"expires_in_days"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in CreateAccessTokenHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+	if reqBody.Name == "" || len(reqBody.Scopes) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "name and scopes are required",
+		})
+	}
+	for _, scope := range reqBody.Scopes {
+		if !scope.IsValid() {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "unknown scope " + string(scope),
+			})
+		}
+	}
+	if reqBody.ExpiresInDays == 0 {
+		reqBody.ExpiresInDays = 90
+	}
+	if reqBody.ExpiresInDays < 1 || reqBody.ExpiresInDays > maxAccessTokenDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "expires_in_days must be between 1 and 365",
+		})
+	}
+	if _, err := util.BinarySearch(account.Users, entity.User{ID: reqBody.UserID}); err != nil {
+		log.Printf("User %d is not on account %d in CreateAccessTokenHandler", reqBody.UserID, account.ID)
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	raw, err := newAccessTokenValue()
+	if err != nil {
+		log.Printf("Failed to generate access token in CreateAccessTokenHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	token := &entity.AccessToken{
+		AccountID: account.ID,
+		UserID:    reqBody.UserID,
+		Name:      reqBody.Name,
+		Prefix:    raw[:len(accessTokenPrefix)+6],
+		Scopes:    reqBody.Scopes,
+		ExpiresAt: time.Now().AddDate(0, 0, reqBody.ExpiresInDays),
+	}
+	if err := db.AddAccessToken(token, raw); err != nil {
+		log.Printf("Failed to add access token in CreateAccessTokenHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"token":        raw,
+		"access_token": token,
+	})
+}
+
+func DeleteAccessTokenHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in DeleteAccessTokenHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	tokenID, err := c.ParamsInt("tokenID", -1)
+	if err != nil || tokenID < 1 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	deleted, err := db.DeleteAccessToken(account.ID, uint(tokenID))
+	if err != nil {
+		log.Printf("Failed to delete access token in DeleteAccessTokenHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if deleted == 0 {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/authz"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/gateway/mail"
+)
+
+func organizationAuditEntry(actor *entity.Account, organizationID uint, action string, transfer *entity.OwnershipTransfer) *entity.AuditEntry {
+	details := map[string]string{
+		"from_account_id": fmt.Sprint(transfer.FromAccountID),
+		"to_account_id":   fmt.Sprint(transfer.ToAccountID),
+	}
+	if transfer.ID != 0 {
+		details["transfer_id"] = fmt.Sprint(transfer.ID)
+	}
+	return &entity.AuditEntry{
+		ActorAccountID: actor.ID,
+		Action:         action,
+		SubjectType:    "organization",
+		SubjectID:      organizationID,
+		Details:        details,
+	}
+}
+
+func sendTransferEmail(account *entity.Account, organization *entity.User) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	link := fmt.Sprintf("%s/organizations/%d", siteURL, organization.ID)
+	err := mailTransport.Send(ctx, &mail.Message{
+		To:      account.Email,
+		Subject: fmt.Sprintf("You have been asked to take over %s on Toro Space", organization.DisplayName),
+		Text: fmt.Sprintf("Hi %s,\n\nYou have been asked to become the owner of %s on Toro Space.\nSign in to accept: %s\n",
+			account.FirstName, organization.DisplayName, link),
+	})
+	if err != nil {
+		log.Printf("Failed to send transfer email to account %d: %s", account.ID, err)
+	}
+}
+
+// currentOwnerID picks the account a transfer moves ownership away from: the
+// initiator when they own the organization, otherwise its longest-standing
+// active owner, or zero when there is none.
+func currentOwnerID(organizationID uint, initiator *entity.Account) (uint, error) {
+	members, err := db.GetOrganizationMembers(organizationID)
+	if err != nil {
+		return 0, err
+	}
+	var ownerID uint
+	for _, member := range members {
+		if member.Role != entity.MemberRoleOwner || member.Status != entity.MemberStatusActive {
+			continue
+		}
+		if member.AccountID == initiator.ID {
+			return member.AccountID, nil
+		}
+		if ownerID == 0 {
+			ownerID = member.AccountID
+		}
+	}
+	return ownerID, nil
+}
+
+func StartOwnershipTransferHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in StartOwnershipTransferHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	reqBody := struct {
+		Email string `json:"email"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in StartOwnershipTransferHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	organization, err := db.GetOrganization(organizationID)
+	if err != nil || organization.Role != entity.RoleOrganization {
+		log.Println("Failed to get organization in StartOwnershipTransferHandler")
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	target, err := db.GetAccountByEmail(strings.TrimSpace(reqBody.Email))
+	if err != nil {
+		log.Printf("No account for %q in StartOwnershipTransferHandler", reqBody.Email)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	fromAccountID, err := currentOwnerID(organizationID, account)
+	if err != nil {
+		log.Printf("Failed to get owner in StartOwnershipTransferHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if fromAccountID == target.ID {
+		log.Printf("Account %d already owns %d in StartOwnershipTransferHandler", target.ID, organizationID)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	transfer := &entity.OwnershipTransfer{
+		OrganizationID:       organizationID,
+		FromAccountID:        fromAccountID,
+		ToAccountID:          target.ID,
+		ToAccount:            *target,
+		InitiatedByAccountID: account.ID,
+		Status:               entity.TransferPending,
+	}
+	entry := organizationAuditEntry(account, organizationID, "ownership_transfer.started", transfer)
+	if err := db.AddOwnershipTransfer(transfer, entry); err != nil {
+		log.Printf("Failed to add transfer in StartOwnershipTransferHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	sendTransferEmail(target, organization)
+	return c.Status(fiber.StatusCreated).JSON(transfer)
+}
+
+func GetOwnershipTransferHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	transfer, err := db.GetPendingOwnershipTransfer(organizationID)
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	return c.JSON(fiber.Map{
+		"transfer": transfer,
+		"to_account": fiber.Map{
+			"first_name": transfer.ToAccount.FirstName,
+			"last_name":  transfer.ToAccount.LastName,
+			"email":      transfer.ToAccount.Email,
+		},
+	})
+}
+
+// CancelOwnershipTransferHandler lets an owner withdraw a pending transfer
+// and lets its target decline it.
+func CancelOwnershipTransferHandler(c *fiber.Ctx) error {
+	organizationID, err := c.ParamsInt("organizationID", -1)
+	if err != nil || organizationID < 1 {
+		log.Println("Failed to get organizationID from params in CancelOwnershipTransferHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in CancelOwnershipTransferHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	transfer, err := db.GetPendingOwnershipTransfer(uint(organizationID))
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	action := "ownership_transfer.declined"
+	if transfer.ToAccountID != account.ID {
+		if status := authorize(c, authz.TransferOrganization); status != fiber.StatusOK {
+			return c.SendStatus(status)
+		}
+		action = "ownership_transfer.cancelled"
+	}
+
+	entry := organizationAuditEntry(account, transfer.OrganizationID, action, transfer)
+	if err := db.CancelOwnershipTransfer(transfer, entry); err != nil {
+		log.Printf("Failed to cancel transfer in CancelOwnershipTransferHandler: %s", err)
+		return c.SendStatus(fiber.StatusConflict)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func AcceptOwnershipTransferHandler(c *fiber.Ctx) error {
+	organizationID, err := c.ParamsInt("organizationID", -1)
+	if err != nil || organizationID < 1 {
+		log.Println("Failed to get organizationID from params in AcceptOwnershipTransferHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in AcceptOwnershipTransferHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	transfer, err := db.GetPendingOwnershipTransfer(uint(organizationID))
+	if err != nil || transfer.ToAccountID != account.ID {
+		log.Printf("No pending transfer for account %d in AcceptOwnershipTransferHandler", account.ID)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	entry := organizationAuditEntry(account, transfer.OrganizationID, "ownership_transfer.accepted", transfer)
+	if err := db.AcceptOwnershipTransfer(transfer, entry); err != nil {
+		log.Printf("Failed to accept transfer in AcceptOwnershipTransferHandler: %s", err)
+		return c.SendStatus(fiber.StatusConflict)
+	}
+	return c.JSON(transfer)
+}
+
+func GetAccountTransfersHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetAccountTransfersHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	transfers, err := db.GetAccountOwnershipTransfers(account.ID)
+	if err != nil {
+		log.Printf("Failed to get transfers in GetAccountTransfersHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"transfers": transfers,
+	})
+}
+
+func GetOrganizationAuditHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	entries, err := db.GetAuditEntries("organization", organizationID)
+	if err != nil {
+		log.Printf("Failed to get audit entries in GetOrganizationAuditHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"entries": entries,
+	})
+}
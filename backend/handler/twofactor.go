@@ -0,0 +1,520 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/authz"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/sqlite"
+	"torospace.csudh.edu/api/totp"
+)
+
+const (
+	twoFactorIssuer = "Toro Space"
+	// stepUpWindow is how long a verification unlocks sensitive routes
+	stepUpWindow      = 10 * time.Minute
+	pendingLoginLimit = 5 * time.Minute
+	maxLoginAttempts  = 5
+	recoveryCodeCount = 10
+
+	// From maxCodeFailures wrong codes in a row the authenticator is locked
+	// for codeLockout, doubling with each further one up to maxCodeLockout
+	maxCodeFailures = 5
+	codeLockout     = 5 * time.Minute
+	maxCodeLockout  = 24 * time.Hour
+)
+
+var (
+	// requireStaffTwoFactor keeps admin and moderator personas unusable
+	// until the account has enrolled an authenticator
+	requireStaffTwoFactor bool
+
+	errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+func init() {
+	requireStaffTwoFactor = os.Getenv("REQUIRE_STAFF_TWO_FACTOR") == "true"
+}
+
+// staffTwoFactorMissing reports whether the persona role may not be used
+// by the account yet because it has no authenticator.
+func staffTwoFactorMissing(accountID uint, role entity.Role) bool {
+	if !requireStaffTwoFactor || (role != entity.RoleAdmin && role != entity.RoleModerator) {
+		return false
+	}
+	enabled, err := db.HasTwoFactor(accountID)
+	if err != nil {
+		log.Printf("Failed to check two-factor of account %d: %s", accountID, err)
+		return true
+	}
+	return !enabled
+}
+
+func twoFactorAuditEntry(accountID uint, action string) *entity.AuditEntry {
+	return &entity.AuditEntry{
+		ActorAccountID: accountID,
+		Action:         action,
+		SubjectType:    "account",
+		SubjectID:      accountID,
+	}
+}
+
+// newRecoveryCodes returns codes like "k3vq-7ztm".
+func newRecoveryCodes() ([]string, error) {
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(encoding.EncodeToString(b))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+	return codes, nil
+}
+
+// twoFactorLockout is how long failures wrong codes in a row lock the
+// account's authenticator for.
+func twoFactorLockout(failures int) time.Duration {
+	if failures < maxCodeFailures {
+		return 0
+	}
+	lockout := codeLockout
+	for i := maxCodeFailures; i < failures && lockout < maxCodeLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, maxCodeLockout)
+}
+
+// checkTwoFactorCode accepts a current authenticator code, once, or an
+// unused recovery code. Every code counts towards the account's lockout
+// until it is found right, and none is looked at while locked.
+func checkTwoFactorCode(twoFactor *entity.TwoFactor, code string) error {
+	if err := db.CountTwoFactorAttempt(twoFactor.AccountID, time.Now(), twoFactorLockout); err != nil {
+		return err
+	}
+	if err := matchTwoFactorCode(twoFactor, code); err != nil {
+		return err
+	}
+	return db.ClearTwoFactorAttempts(twoFactor.AccountID)
+}
+
+func matchTwoFactorCode(twoFactor *entity.TwoFactor, code string) error {
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(twoFactor.Secret, code, time.Now()); ok {
+		err := db.UseTwoFactorStep(twoFactor, step)
+		if errors.Is(err, sqlite.ErrCodeReused) {
+			return errInvalidTwoFactorCode
+		}
+		return err
+	}
+	if len(code) == totp.Digits {
+		return errInvalidTwoFactorCode
+	}
+
+	used, err := db.UseRecoveryCode(twoFactor.AccountID, code)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return errInvalidTwoFactorCode
+	}
+	if err := db.AddAuditEntry(twoFactorAuditEntry(twoFactor.AccountID, "two_factor.recovery_code_used")); err != nil {
+		log.Printf("Failed to audit recovery code use of account %d: %s", twoFactor.AccountID, err)
+	}
+	return nil
+}
+
+// checkAccountTwoFactorCode checks the code against the account's enabled
+// authenticator and returns the status to respond with when it fails.
+func checkAccountTwoFactorCode(accountID uint, code string) int {
+	twoFactor, err := db.GetTwoFactor(accountID)
+	if err != nil || !twoFactor.IsEnabled() {
+		return fiber.StatusNotFound
+	}
+	if err := checkTwoFactorCode(twoFactor, code); err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			return fiber.StatusBadRequest
+		}
+		if errors.Is(err, sqlite.ErrTwoFactorLocked) {
+			log.Printf("Two-factor of account %d is locked", accountID)
+			return fiber.StatusTooManyRequests
+		}
+		log.Printf("Failed to check two-factor code of account %d: %s", accountID, err)
+		return fiber.StatusInternalServerError
+	}
+	return fiber.StatusOK
+}
+
+// markTwoFactorVerified starts the step-up window of the cookie session.
+func markTwoFactorVerified(c *fiber.Ctx) (time.Time, error) {
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now()
+	sess.Set("twoFactorVerifiedAt", now.Unix())
+	return now.Add(stepUpWindow), sess.Save()
+}
+
+func parseTwoFactorCode(c *fiber.Ctx) (string, bool) {
+	reqBody := struct {
+		Code string `json:"code"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil || strings.TrimSpace(reqBody.Code) == "" {
+		return "", false
+	}
+	return reqBody.Code, true
+}
+
+func GetTwoFactorHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in GetTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	response := fiber.Map{
+		"enabled":    false,
+		"enabled_at": nil,
+		"required":   false,
+	}
+	if requireStaffTwoFactor {
+		_, err := db.GetStaffGrant(account.ID)
+		response["required"] = err == nil
+	}
+	twoFactor, err := db.GetTwoFactor(account.ID)
+	if err != nil || !twoFactor.IsEnabled() {
+		return c.JSON(response)
+	}
+	remaining, err := db.CountRecoveryCodes(account.ID)
+	if err != nil {
+		log.Printf("Failed to count recovery codes in GetTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	response["enabled"] = true
+	response["enabled_at"] = twoFactor.EnabledAt
+	response["recovery_codes_left"] = remaining
+	return c.JSON(response)
+}
+
+// StartTwoFactorHandler begins enrollment. The secret and provisioning URI
+// are for the authenticator app, usually shown as a QR code, and stay
+// pending until ConfirmTwoFactorHandler gets a code from the app.
+func StartTwoFactorHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in StartTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if principal, _ := getPrincipal(c); principal.Impersonation != nil {
+		log.Println("Refusing two-factor enrollment while impersonating in StartTwoFactorHandler")
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	if twoFactor, err := db.GetTwoFactor(account.ID); err == nil && twoFactor.IsEnabled() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		log.Printf("Failed to generate secret in StartTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if err := db.SetPendingTwoFactor(&entity.TwoFactor{AccountID: account.ID, Secret: secret}); err != nil {
+		log.Printf("Failed to save pending two-factor in StartTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(twoFactorIssuer, account.Email, secret),
+	})
+}
+
+// ConfirmTwoFactorHandler enables the pending authenticator and returns the
+// recovery codes, which are shown only this once.
+func ConfirmTwoFactorHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in ConfirmTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if principal, _ := getPrincipal(c); principal.Impersonation != nil {
+		log.Println("Refusing two-factor enrollment while impersonating in ConfirmTwoFactorHandler")
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	code, ok := parseTwoFactorCode(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	twoFactor, err := db.GetTwoFactor(account.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.SendStatus(fiber.StatusNotFound)
+	} else if err != nil {
+		log.Printf("Failed to get two-factor in ConfirmTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if twoFactor.IsEnabled() {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "two-factor authentication is already enabled",
+		})
+	}
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now())
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid code",
+		})
+	}
+
+	recoveryCodes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Failed to generate recovery codes in ConfirmTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if err := db.EnableTwoFactor(twoFactor, step, recoveryCodes, twoFactorAuditEntry(account.ID, "two_factor.enabled")); err != nil {
+		log.Printf("Failed to enable two-factor in ConfirmTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if _, err := markTwoFactorVerified(c); err != nil {
+		log.Printf("Failed to save session in ConfirmTwoFactorHandler: %s", err)
+	}
+	return c.JSON(fiber.Map{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// VerifyTwoFactorHandler is the step-up check: a code unlocks the routes
+// guarded by RequireStepUp for stepUpWindow.
+func VerifyTwoFactorHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in VerifyTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	code, ok := parseTwoFactorCode(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if status := checkAccountTwoFactorCode(account.ID, code); status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+
+	verifiedUntil, err := markTwoFactorVerified(c)
+	if err != nil {
+		log.Printf("Failed to save session in VerifyTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"verified_until": verifiedUntil,
+	})
+}
+
+// RegenerateRecoveryCodesHandler replaces all recovery codes, used or not.
+func RegenerateRecoveryCodesHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in RegenerateRecoveryCodesHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if principal, _ := getPrincipal(c); principal.Impersonation != nil {
+		log.Println("Refusing to replace recovery codes while impersonating in RegenerateRecoveryCodesHandler")
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	code, ok := parseTwoFactorCode(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if status := checkAccountTwoFactorCode(account.ID, code); status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+
+	recoveryCodes, err := newRecoveryCodes()
+	if err != nil {
+		log.Printf("Failed to generate recovery codes in RegenerateRecoveryCodesHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if err := db.ReplaceRecoveryCodes(account.ID, recoveryCodes, twoFactorAuditEntry(account.ID, "two_factor.recovery_codes_replaced")); err != nil {
+		log.Printf("Failed to replace recovery codes in RegenerateRecoveryCodesHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+func DisableTwoFactorHandler(c *fiber.Ctx) error {
+	account, err := getSessionAccount(c)
+	if err != nil {
+		log.Printf("Failed to get account in DisableTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if principal, _ := getPrincipal(c); principal.Impersonation != nil {
+		log.Println("Refusing to disable two-factor while impersonating in DisableTwoFactorHandler")
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	code, ok := parseTwoFactorCode(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if status := checkAccountTwoFactorCode(account.ID, code); status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+
+	if err := db.DisableTwoFactor(account.ID, twoFactorAuditEntry(account.ID, "two_factor.disabled")); err != nil {
+		log.Printf("Failed to disable two-factor in DisableTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		log.Printf("Failed to get session in DisableTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	sess.Delete("twoFactorVerifiedAt")
+	if err := sess.Save(); err != nil {
+		log.Printf("Failed to save session in DisableTwoFactorHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// VerifyLoginHandler finishes a login held back by AuthCallbackHandler for
+// an account with two-factor authentication. The session is dropped after
+// too many wrong codes.
+func VerifyLoginHandler(c *fiber.Ctx) error {
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		log.Printf("Failed to get session in VerifyLoginHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	accountID, ok := sess.Get("pendingAccountID").(uint)
+	if !ok {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	code, ok := parseTwoFactorCode(c)
+	if !ok {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	twoFactor, err := db.GetTwoFactor(accountID)
+	if err == nil && twoFactor.IsEnabled() {
+		err = checkTwoFactorCode(twoFactor, code)
+	} else if err == nil {
+		err = errInvalidTwoFactorCode
+	}
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		attempts, _ := sess.Get("loginAttempts").(int)
+		attempts++
+		if attempts >= maxLoginAttempts {
+			log.Printf("Too many two-factor attempts for account %d", accountID)
+			if err := sess.Destroy(); err != nil {
+				log.Printf("Failed to destroy session in VerifyLoginHandler: %s", err)
+			}
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		sess.Set("loginAttempts", attempts)
+		if err := sess.Save(); err != nil {
+			log.Printf("Failed to save session in VerifyLoginHandler: %s", err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "invalid code",
+		})
+	} else if errors.Is(err, sqlite.ErrTwoFactorLocked) {
+		log.Printf("Two-factor of account %d is locked in VerifyLoginHandler", accountID)
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "too many wrong codes, try again later",
+		})
+	} else if err != nil {
+		log.Printf("Failed to check two-factor code in VerifyLoginHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	sess.Delete("pendingAccountID")
+	sess.Delete("loginAttempts")
+	sess.Set("accountID", accountID)
+	sess.Set("twoFactorVerifiedAt", time.Now().Unix())
+	sess.SetExpiry(30 * time.Minute)
+	if err := sess.Save(); err != nil {
+		log.Printf("Failed to save session in VerifyLoginHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// isStaffAccount reports whether the principal acts as staff or its
+// account holds a staff role for any of its personas.
+func isStaffAccount(principal *authz.Principal) (bool, error) {
+	if principal.Role == entity.RoleAdmin || principal.Role == entity.RoleModerator {
+		return true, nil
+	}
+	_, err := db.GetStaffGrant(principal.AccountID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RequireStepUp guards sensitive routes behind a two-factor verification
+// of the cookie session within stepUpWindow. It goes after Authorize. Staff
+// accounts must have enrolled, other accounts are asked once they have.
+func RequireStepUp(c *fiber.Ctx) error {
+	principal, err := getPrincipal(c)
+	if err != nil {
+		log.Printf("Failed to get principal in RequireStepUp: %s", err)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+	if principal.Token {
+		log.Printf("Refused access token on %s in RequireStepUp", c.Path())
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+	if c.Locals("authorized") == nil {
+		log.Printf("RequireStepUp on %s is missing Authorize", c.Path())
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	enabled, err := db.HasTwoFactor(principal.AccountID)
+	if err != nil {
+		log.Printf("Failed to check two-factor in RequireStepUp: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if !enabled {
+		staff, err := isStaffAccount(principal)
+		if err != nil {
+			log.Printf("Failed to check staff grant in RequireStepUp: %s", err)
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+		if !staff {
+			return c.Next()
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":      "two-factor authentication is required",
+			"two_factor": "enroll",
+		})
+	}
+
+	sess, err := sessionStore.Get(c)
+	if err != nil {
+		log.Printf("Failed to get session in RequireStepUp: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	verifiedAt, ok := sess.Get("twoFactorVerifiedAt").(int64)
+	if !ok || time.Since(time.Unix(verifiedAt, 0)) > stepUpWindow {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":      "two-factor verification required",
+			"two_factor": "verify",
+		})
+	}
+	return c.Next()
+}
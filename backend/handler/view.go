@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/views"
+)
+
+const (
+	// viewWindow is how long a viewer's repeat views of a post are ignored.
+	viewWindow = 30 * time.Minute
+	// maxTrackedViews bounds the memory of the tracker
+	maxTrackedViews = 200000
+	// maxViewsPerSource is how many views one account or anonymous client
+	// address can add per viewWindow
+	maxViewsPerSource = 300
+)
+
+var viewTracker *views.Tracker
+
+func init() {
+	viewTracker = views.NewTracker(viewWindow, maxTrackedViews, maxViewsPerSource)
+}
+
+// viewerKey identifies who is viewing: the signed-in account, or a hash of
+// the client address and user agent for anonymous visitors. The source is
+// what the view budget is kept for; anonymous visitors share one per
+// address, so changing the user agent doesn't add views.
+func viewerKey(c *fiber.Ctx) (viewer string, source string) {
+	if auth, err := getPrincipal(c); err == nil {
+		viewer = fmt.Sprintf("account:%d", auth.AccountID)
+		return viewer, viewer
+	}
+	sum := sha256.Sum256([]byte(c.IP() + "\x00" + c.Get(fiber.HeaderUserAgent)))
+	return "anonymous:" + hex.EncodeToString(sum[:16]), "address:" + c.IP()
+}
+
+func recordView(c *fiber.Ctx, postID uint, now time.Time) {
+	viewer, source := viewerKey(c)
+	viewTracker.Record(viewer, source, postID, now)
+}
+
+// StartViewJob writes buffered view counts to the database in batches.
+// Counts not yet written when the process stops are lost.
+func StartViewJob(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				flushViews()
+				return
+			case <-ticker.C:
+				flushViews()
+			}
+		}
+	}()
+}
+
+func flushViews() {
+	counts := viewTracker.Take(time.Now())
+	if len(counts) == 0 {
+		return
+	}
+	if err := db.AddPostViews(counts); err != nil {
+		log.Printf("Failed to write %d post view counts: %s", len(counts), err)
+		viewTracker.Restore(counts)
+	}
+}
+
+// ReportPostViewsHandler records views of the posts a client reports as
+// having scrolled into its viewport.
+func ReportPostViewsHandler(c *fiber.Ctx) error {
+	reqBody := struct {
+		PostIDs []uint `json:"post_ids"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in ReportPostViewsHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if len(reqBody.PostIDs) > 100 {
+		log.Println("Too many post IDs in ReportPostViewsHandler")
+		return c.SendStatus(fiber.StatusRequestEntityTooLarge)
+	}
+
+	// Only posts the caller could have seen count
+	postIDs, err := db.FilterViewablePostIDs(postAudience(c), reqBody.PostIDs)
+	if err != nil {
+		log.Printf("Failed to filter posts in ReportPostViewsHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	now := time.Now()
+	for _, postID := range postIDs {
+		recordView(c, postID, now)
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,363 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/event"
+	"torospace.csudh.edu/api/gateway/netguard"
+	"torospace.csudh.edu/api/gateway/webhook"
+	"torospace.csudh.edu/api/sqlite"
+)
+
+const (
+	webhookMaxAttempts = 8
+	webhookBaseBackoff = 30 * time.Second
+	webhookMaxBackoff  = 6 * time.Hour
+)
+
+var (
+	webhookGateway webhook.WebhookGateway
+)
+
+func init() {
+	webhookGateway = webhook.New(os.Getenv("WEBHOOK_ALLOW_HTTP") == "true")
+}
+
+func enqueueWebhookEvent(e *event.Event) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Failed to marshal webhook payload: %s", err)
+		return
+	}
+	for _, organizationID := range e.OrganizationIDs() {
+		if err := db.EnqueueWebhookDeliveries(organizationID, string(e.Type), payload); err != nil {
+			log.Printf("Failed to enqueue webhook deliveries of organization %d: %s", organizationID, err)
+		}
+	}
+}
+
+// StartWebhookJob delivers pending webhook deliveries. The queue lives in the
+// database, so deliveries survive restarts and are retried with exponential
+// backoff until webhookMaxAttempts is reached.
+func StartWebhookJob(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				deliverDueWebhooks(ctx)
+			}
+		}
+	}()
+}
+
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+func deliverDueWebhooks(ctx context.Context) {
+	deliveries, err := db.GetDueWebhookDeliveries(time.Now(), 50)
+	if err != nil {
+		log.Printf("Failed to get due webhook deliveries: %s", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		deliverWebhook(ctx, delivery)
+		if err := db.SaveWebhookDelivery(delivery); err != nil {
+			log.Printf("Failed to save webhook delivery %d: %s", delivery.ID, err)
+		}
+	}
+}
+
+func deliverWebhook(ctx context.Context, delivery *entity.WebhookDelivery) {
+	// The webhook was deleted after the delivery was queued
+	if delivery.Webhook.ID == 0 || !delivery.Webhook.Active {
+		delivery.Status = entity.WebhookDeliveryFailed
+		delivery.LastError = "webhook was removed or disabled"
+		return
+	}
+
+	body, err := webhookBody(&delivery.Webhook, delivery)
+	if err != nil {
+		delivery.Status = entity.WebhookDeliveryFailed
+		delivery.LastError = err.Error()
+		return
+	}
+
+	deliverCtx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	statusCode, err := webhookGateway.Deliver(deliverCtx, &webhook.Request{
+		URL:        delivery.Webhook.URL,
+		Secret:     delivery.Webhook.Secret,
+		EventType:  delivery.EventType,
+		DeliveryID: delivery.ID,
+		Body:       body,
+	})
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		now := time.Now()
+		delivery.Status = entity.WebhookDeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= webhookMaxAttempts {
+		delivery.Status = entity.WebhookDeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+}
+
+// webhookBody converts the stored event payload into the request body the
+// webhook expects. Discord webhooks only understand their own message format.
+func webhookBody(w *entity.Webhook, delivery *entity.WebhookDelivery) ([]byte, error) {
+	if w.Format != entity.WebhookFormatDiscord {
+		return []byte(delivery.Payload), nil
+	}
+
+	e := &event.Event{}
+	if err := json.Unmarshal([]byte(delivery.Payload), e); err != nil {
+		return nil, err
+	}
+
+	postURL := fmt.Sprintf("%s/posts/%d", siteURL, e.PostID)
+	var content string
+	switch e.Type {
+	case event.TypePostCreated:
+		// Restricted posts carry no body, so only link to them
+		if e.Post == nil {
+			content = fmt.Sprintf("A new post was published on Toro Space: %s", postURL)
+			break
+		}
+		content = fmt.Sprintf("**%s** posted on Toro Space:\n%s\n%s", e.Post.Author.DisplayName, e.Post.Content, postURL)
+	case event.TypePostLiked:
+		content = fmt.Sprintf("A post now has %d likes: %s", e.Likes, postURL)
+	case event.TypePostHidden:
+		content = fmt.Sprintf("Post %d was hidden", e.PostID)
+	case event.TypePostUnhidden:
+		content = fmt.Sprintf("Post %d is visible again: %s", e.PostID, postURL)
+	case event.TypePostDeleted:
+		content = fmt.Sprintf("Post %d was deleted", e.PostID)
+	case event.TypePostUpdated:
+		content = fmt.Sprintf("Post %d was edited: %s", e.PostID, postURL)
+	default:
+		content = fmt.Sprintf("%s: %s", e.Type, postURL)
+	}
+	return json.Marshal(fiber.Map{
+		"content": content,
+	})
+}
+
+// validateWebhookURL refuses URLs that aren't https or that point at the
+// server's own network. The gateway checks the address again when it dials.
+func validateWebhookURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Host == "" {
+		return fmt.Errorf("webhook url %q has no host", rawURL)
+	}
+	// Plain http and local addresses are only for testing against a local
+	// receiver
+	if os.Getenv("WEBHOOK_ALLOW_HTTP") == "true" {
+		if u.Scheme == "https" || u.Scheme == "http" {
+			return nil
+		}
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("webhook url %q must use https", rawURL)
+	}
+	return netguard.CheckHost(ctx, u.Hostname())
+}
+
+func newWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+func GetWebhooksHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	webhooks, err := db.GetWebhooks(organizationID)
+	if err != nil {
+		log.Printf("Failed to get webhooks in GetWebhooksHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(fiber.Map{
+		"webhooks": webhooks,
+	})
+}
+
+func CreateWebhookHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	reqBody := struct {
+		URL    string               `json:"url"`
+		Events []string             `json:"events"`
+		Format entity.WebhookFormat `json:"format"`
+	}{}
+	if err := c.BodyParser(&reqBody); err != nil {
+		log.Printf("Failed to parse request body in CreateWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if err := validateWebhookURL(c.Context(), reqBody.URL); err != nil {
+		log.Printf("Invalid url in CreateWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	if len(reqBody.Events) < 1 {
+		log.Println("No events in CreateWebhookHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	for _, eventType := range reqBody.Events {
+		if !event.IsValidType(eventType) {
+			log.Printf("Invalid event %q in CreateWebhookHandler", eventType)
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+	}
+	if reqBody.Format == "" {
+		reqBody.Format = entity.WebhookFormatJSON
+	}
+	if reqBody.Format != entity.WebhookFormatJSON && reqBody.Format != entity.WebhookFormatDiscord {
+		log.Printf("Invalid format %q in CreateWebhookHandler", reqBody.Format)
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		log.Printf("Failed to generate secret in CreateWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	newWebhook := &entity.Webhook{
+		OrganizationID: organizationID,
+		URL:            reqBody.URL,
+		Format:         reqBody.Format,
+		Events:         reqBody.Events,
+		Secret:         secret,
+		Active:         true,
+	}
+	if err := db.CreateWebhook(newWebhook); err != nil {
+		log.Printf("Failed to create webhook in CreateWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	// The secret is only ever shown once
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"webhook": newWebhook,
+		"secret":  secret,
+	})
+}
+
+func DeleteWebhookHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	webhookID, err := c.ParamsInt("webhookID", -1)
+	if err != nil || webhookID < 1 {
+		log.Println("Failed to get webhookID from params in DeleteWebhookHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	existing, err := db.GetWebhook(organizationID, uint(webhookID))
+	if err != nil {
+		log.Printf("Failed to get webhook in DeleteWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if err := db.DeleteWebhook(existing); err != nil {
+		log.Printf("Failed to delete webhook in DeleteWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func GetWebhookDeliveriesHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	webhookID, err := c.ParamsInt("webhookID", -1)
+	if err != nil || webhookID < 1 {
+		log.Println("Failed to get webhookID from params in GetWebhookDeliveriesHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if _, err := db.GetWebhook(organizationID, uint(webhookID)); err != nil {
+		log.Printf("Failed to get webhook in GetWebhookDeliveriesHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	deliveriesResult, err := db.GetWebhookDeliveries(uint(webhookID), &sqlite.WebhookDeliveryParams{
+		Before:   c.Query("before", ""),
+		PageSize: c.QueryInt("page_size", 20),
+	})
+	if err != nil {
+		log.Printf("Failed to get deliveries in GetWebhookDeliveriesHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(deliveriesResult)
+}
+
+func RedeliverWebhookHandler(c *fiber.Ctx) error {
+	organizationID := authorizedOrganizationID(c)
+
+	webhookID, err := c.ParamsInt("webhookID", -1)
+	if err != nil || webhookID < 1 {
+		log.Println("Failed to get webhookID from params in RedeliverWebhookHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+	deliveryID, err := c.ParamsInt("deliveryID", -1)
+	if err != nil || deliveryID < 1 {
+		log.Println("Failed to get deliveryID from params in RedeliverWebhookHandler")
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if _, err := db.GetWebhook(organizationID, uint(webhookID)); err != nil {
+		log.Printf("Failed to get webhook in RedeliverWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	delivery, err := db.GetWebhookDelivery(uint(webhookID), uint(deliveryID))
+	if err != nil {
+		log.Printf("Failed to get delivery in RedeliverWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	delivery.Status = entity.WebhookDeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+	if err := db.SaveWebhookDelivery(delivery); err != nil {
+		log.Printf("Failed to save delivery in RedeliverWebhookHandler: %s", err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	return c.JSON(delivery)
+}
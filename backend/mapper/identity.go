@@ -0,0 +1,33 @@
+package mapper
+
+import (
+	"strings"
+
+	"torospace.csudh.edu/api/entity"
+	"torospace.csudh.edu/api/gateway/identity"
+)
+
+// IdentityToAccount is the account created on first login, with a student
+// persona. Staff roles are granted separately.
+func IdentityToAccount(ident *identity.Identity) *entity.Account {
+	return &entity.Account{
+		FirstName: ident.GivenName,
+		LastName:  ident.FamilyName,
+		Email:     ident.Email,
+		Users: []entity.User{
+			{
+				DisplayName: strings.Split(ident.Email, "@")[0],
+				AvatarUrl:   ident.Picture,
+				Role:        entity.RoleStudent,
+			},
+		},
+	}
+}
+
+func IdentityToAccountIdentity(ident *identity.Identity) *entity.AccountIdentity {
+	return &entity.AccountIdentity{
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+		Email:    ident.Email,
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/monitor"
+	"torospace.csudh.edu/api/authz"
 	"torospace.csudh.edu/api/handler"
 )
 
@@ -45,9 +46,12 @@ func SetupRoutes(app *fiber.App) {
 		Next:         limiterNext,
 		LimitReached: limiterReached,
 	}))
+	// Who the request acts as, for handler.Authorize
+	app.Use(handler.LoadPrincipal)
 
 	// Endpoint: /
 	app.Get("/", handler.HelloHandler)
+	app.Get("/feed.:format", handler.GetFeedHandler)
 	app.Get("/monitor", monitor.New(monitor.Config{
 		Title: "Toro Space Monitor",
 	}))
@@ -55,36 +59,129 @@ func SetupRoutes(app *fiber.App) {
 	app.Get("/account/:accountID", handler.GetAccountHandler)
 	app.Get("/account/:accountID/user/:userID", handler.GetUserHandler)
 	app.Put("/account/:accountID/user/:userID/select", handler.SelectUserHandler)
-	app.Post("/account/:accountID/user/:userID/post", handler.CreatePostHandler)
+	app.Post("/account/:accountID/user/:userID/post", handler.Authorize(authz.CreatePost), handler.CreatePostHandler)
+	app.Get("/account/:accountID/identities", handler.GetAccountIdentitiesHandler)
+	app.Get("/account/:accountID/export", handler.ExportAccountHandler)
+	app.Get("/account/:accountID/deletion", handler.GetAccountDeletionHandler)
+	app.Post("/account/:accountID/deletion", handler.RequestAccountDeletionHandler)
+	app.Delete("/account/:accountID/deletion", handler.CancelAccountDeletionHandler)
+	app.Get("/account/:accountID/two-factor", handler.GetTwoFactorHandler)
+	app.Post("/account/:accountID/two-factor", handler.StartTwoFactorHandler)
+	app.Delete("/account/:accountID/two-factor", handler.DisableTwoFactorHandler)
+	app.Post("/account/:accountID/two-factor/confirm", handler.ConfirmTwoFactorHandler)
+	app.Post("/account/:accountID/two-factor/verify", handler.VerifyTwoFactorHandler)
+	app.Post("/account/:accountID/two-factor/recovery-codes", handler.RegenerateRecoveryCodesHandler)
+	app.Get("/account/:accountID/tokens", handler.GetAccessTokensHandler)
+	app.Post("/account/:accountID/tokens", handler.Authorize(authz.CreateAccessToken), handler.RequireStepUp, handler.CreateAccessTokenHandler)
+	app.Delete("/account/:accountID/tokens/:tokenID", handler.DeleteAccessTokenHandler)
+	app.Get("/account/:accountID/invitations", handler.GetInvitationsHandler)
+	app.Get("/account/:accountID/transfers", handler.GetAccountTransfersHandler)
+	app.Get("/account/:accountID/applications", handler.GetAccountApplicationsHandler)
+	app.Post("/account/:accountID/applications", handler.CreateApplicationHandler)
+	app.Get("/account/:accountID/digest", handler.GetDigestSubscriptionHandler)
+	app.Put("/account/:accountID/digest", handler.UpdateDigestSubscriptionHandler)
+	app.Get("/account/:accountID/digest/preview", handler.PreviewDigestHandler)
 
 	app.Get("/user/self", handler.GetCurrentUserHandler)
+	app.Delete("/impersonation", handler.EndImpersonationHandler)
+	app.Get("/user/self/sessions", handler.GetSessionsHandler)
+	app.Delete("/user/self/sessions", handler.RevokeSessionsHandler)
+	app.Delete("/user/self/sessions/:sessionID", handler.RevokeSessionHandler)
 
 	// Endpoint: /posts
-	app.Get("/posts", handler.GetPostsHandler)
-	app.Get("/posts/:postID", handler.GetPostHandler)
-	app.Delete("/posts/:postID", handler.DeletePostHandler)
-	app.Put("/posts/:postID", handler.HidePostHandler)
-	app.Post("/posts/:postID/like", handler.LikePostHandler)
+	app.Get("/posts", handler.Authorize(authz.ReadPost), handler.GetPostsHandler)
+	app.Post("/posts/views", handler.ReportPostViewsHandler)
+	app.Get("/posts/:postID", handler.Authorize(authz.ReadPost), handler.GetPostHandler)
+	app.Delete("/posts/:postID", handler.Authorize(authz.DeletePost), handler.DeletePostHandler)
+	app.Put("/posts/:postID", handler.Authorize(authz.HidePost), handler.HidePostHandler)
+	app.Post("/posts/:postID/like", handler.Authorize(authz.LikePost), handler.LikePostHandler)
+	app.Patch("/posts/:postID", handler.Authorize(authz.EditPost), handler.EditPostHandler)
+	app.Post("/posts/:postID/coauthors", handler.Authorize(authz.InviteCoauthor), handler.InvitePostCoauthorHandler)
+	app.Post("/posts/:postID/coauthors/:organizationID/accept", handler.Authorize(authz.AcceptCoauthor), handler.AcceptPostCoauthorHandler)
+	app.Delete("/posts/:postID/coauthors/:organizationID", handler.Authorize(authz.RemoveCoauthor), handler.RemovePostCoauthorHandler)
+
+	// Endpoint: /digest
+	app.Get("/digest/unsubscribe", handler.UnsubscribeDigestHandler)
+	app.Post("/digest/unsubscribe", handler.UnsubscribeDigestHandler)
+
+	// Endpoint: /stream
+	app.Get("/stream", handler.StreamHandler)
 
 	// Endpoint: /topics
 	app.Get("/topics", handler.GetTopicsHandler)
+	app.Get("/topics/:name/feed.:format", handler.GetTopicFeedHandler)
 
 	// Endpoint: /organizations
 	app.Get("/organizations", handler.GetOrganizationsHandler)
+	app.Get("/categories", handler.GetCategoriesHandler)
 	app.Get("/organizations/:organizationID", handler.GetOrganizationHandler)
-	app.Get("/organizations/:organizationID/posts", handler.GetPostsByOrganizationHandler)
-
-	// Endpoint: /auth/google
-	app.Get("/auth/google", handler.GoogleAuthHandler)
-	app.Get("/auth/google/callback", handler.GoogleAuthCallbackHandler)
+	app.Put("/organizations/:organizationID/profile", handler.Authorize(authz.EditOrganization), handler.UpdateOrganizationProfileHandler)
+	app.Get("/organizations/:organizationID/posts", handler.Authorize(authz.ReadPost), handler.GetPostsByOrganizationHandler)
+	app.Get("/organizations/:organizationID/members", handler.Authorize(authz.ManageMembers), handler.GetOrganizationMembersHandler)
+	app.Post("/organizations/:organizationID/members", handler.Authorize(authz.AssignMembers), handler.InviteOrganizationMemberHandler)
+	app.Get("/organizations/:organizationID/members.csv", handler.Authorize(authz.ManageMembers), handler.ExportOrganizationMembersHandler)
+	app.Post("/organizations/:organizationID/members/accept", handler.AcceptOrganizationInviteHandler)
+	app.Post("/organizations/:organizationID/members/:memberAccountID/approve", handler.Authorize(authz.ManageMembers), handler.ApproveJoinRequestHandler)
+	app.Post("/organizations/:organizationID/join", handler.JoinOrganizationHandler)
+	app.Put("/organizations/:organizationID/members/:memberAccountID", handler.Authorize(authz.AssignMembers), handler.UpdateOrganizationMemberHandler)
+	app.Delete("/organizations/:organizationID/members/:memberAccountID", handler.RemoveOrganizationMemberHandler)
+	app.Get("/organizations/:organizationID/transfer", handler.Authorize(authz.TransferOrganization), handler.GetOwnershipTransferHandler)
+	app.Post("/organizations/:organizationID/transfer", handler.Authorize(authz.TransferOrganization), handler.StartOwnershipTransferHandler)
+	app.Delete("/organizations/:organizationID/transfer", handler.CancelOwnershipTransferHandler)
+	app.Post("/organizations/:organizationID/transfer/accept", handler.AcceptOwnershipTransferHandler)
+	app.Get("/organizations/:organizationID/audit", handler.Authorize(authz.ViewOrganizationAudit), handler.GetOrganizationAuditHandler)
+	app.Get("/organizations/:organizationID/coauthor-invites", handler.Authorize(authz.AcceptCoauthor), handler.GetCoauthorInvitesHandler)
+	app.Get("/organizations/:organizationID/analytics", handler.Authorize(authz.ViewAnalytics), handler.GetOrganizationAnalyticsHandler)
+	app.Get("/organizations/:organizationID/analytics.:format", handler.Authorize(authz.ViewAnalytics), handler.GetOrganizationAnalyticsHandler)
+	app.Get("/organizations/:organizationID/analytics/posts", handler.Authorize(authz.ViewAnalytics), handler.GetPostAnalyticsHandler)
+	app.Get("/organizations/:organizationID/analytics/posts.:format", handler.Authorize(authz.ViewAnalytics), handler.GetPostAnalyticsHandler)
+	app.Get("/organizations/:organizationID/feed.:format", handler.GetOrganizationFeedHandler)
+	app.Put("/organizations/:organizationID/federation", handler.Authorize(authz.FederateOrganization), handler.EnableFederationHandler)
+	app.Delete("/organizations/:organizationID/federation", handler.Authorize(authz.FederateOrganization), handler.DisableFederationHandler)
+	app.Get("/organizations/:organizationID/webhooks", handler.Authorize(authz.ManageWebhooks), handler.GetWebhooksHandler)
+	app.Post("/organizations/:organizationID/webhooks", handler.Authorize(authz.ManageWebhooks), handler.CreateWebhookHandler)
+	app.Delete("/organizations/:organizationID/webhooks/:webhookID", handler.Authorize(authz.ManageWebhooks), handler.DeleteWebhookHandler)
+	app.Get("/organizations/:organizationID/webhooks/:webhookID/deliveries", handler.Authorize(authz.ManageWebhooks), handler.GetWebhookDeliveriesHandler)
+	app.Post("/organizations/:organizationID/webhooks/:webhookID/deliveries/:deliveryID/redeliver", handler.Authorize(authz.ManageWebhooks), handler.RedeliverWebhookHandler)
+
+	// Endpoint: /ap (ActivityPub)
+	app.Get("/.well-known/webfinger", handler.WebFingerHandler)
+	app.Get("/ap/users/:organizationID", handler.GetActorHandler)
+	app.Get("/ap/users/:organizationID/outbox", handler.GetOutboxHandler)
+	app.Get("/ap/users/:organizationID/followers", handler.GetFollowersHandler)
+	app.Post("/ap/users/:organizationID/inbox", handler.InboxHandler)
+	app.Get("/ap/posts/:postID", handler.GetActivityPubPostHandler)
+
+	// Endpoint: /auth/:provider
+	app.Get("/auth/providers", handler.GetAuthProvidersHandler)
+	app.Get("/auth/dev/login", handler.DevLoginHandler)
+	app.Post("/auth/dev/login", handler.SubmitDevLoginHandler)
+	app.Post("/auth/two-factor", handler.VerifyLoginHandler)
+	app.Get("/auth/:provider", handler.AuthHandler)
+	app.Get("/auth/:provider/callback", handler.AuthCallbackHandler)
 
 	// Endpoint: /logout
 	app.Get("/logout", handler.LogoutHandler)
 
-	app.Get("/admin", handler.IsAdminHandler)
-	app.Post("/admin/new/user", handler.CreateUserHandler)
-	app.Get("/admin/account/:accountID", handler.GetAccountAdminHandler)
-	app.Post("/admin/new/topic/:topicName", handler.CreateTopicHandler)
+	app.Get("/admin", handler.Authorize(authz.ViewAdmin), handler.IsAdminHandler)
+	app.Post("/admin/new/user", handler.Authorize(authz.CreateUser), handler.RequireStepUp, handler.CreateUserHandler)
+	app.Get("/admin/account/:accountID", handler.Authorize(authz.ViewAccount), handler.GetAccountAdminHandler)
+	app.Post("/admin/account/:targetAccountID/logout", handler.Authorize(authz.LogoutAccount), handler.RequireStepUp, handler.ForceLogoutAccountHandler)
+	app.Get("/admin/impersonations", handler.Authorize(authz.Impersonate), handler.GetImpersonationsHandler)
+	app.Post("/admin/impersonate/:targetAccountID", handler.Authorize(authz.Impersonate), handler.RequireStepUp, handler.StartImpersonationHandler)
+	app.Get("/admin/staff", handler.Authorize(authz.ManageStaff), handler.GetStaffHandler)
+	app.Put("/admin/staff/:targetAccountID", handler.Authorize(authz.ManageStaff), handler.RequireStepUp, handler.SetStaffRoleHandler)
+	app.Delete("/admin/staff/:targetAccountID", handler.Authorize(authz.ManageStaff), handler.RequireStepUp, handler.RemoveStaffRoleHandler)
+	app.Post("/admin/new/topic/:topicName", handler.Authorize(authz.CreateTopic), handler.RequireStepUp, handler.CreateTopicHandler)
+	app.Post("/admin/categories", handler.Authorize(authz.ManageCategories), handler.RequireStepUp, handler.CreateCategoryHandler)
+	app.Delete("/admin/categories/:slug", handler.Authorize(authz.ManageCategories), handler.RequireStepUp, handler.DeleteCategoryHandler)
+	app.Put("/admin/organizations/:organizationID/verified", handler.Authorize(authz.VerifyOrganization), handler.RequireStepUp, handler.SetOrganizationVerifiedHandler)
+	app.Get("/admin/login-exceptions", handler.Authorize(authz.ManageLoginExceptions), handler.GetLoginExceptionsHandler)
+	app.Post("/admin/login-exceptions", handler.Authorize(authz.ManageLoginExceptions), handler.RequireStepUp, handler.CreateLoginExceptionHandler)
+	app.Delete("/admin/login-exceptions/:exceptionID", handler.Authorize(authz.ManageLoginExceptions), handler.RequireStepUp, handler.DeleteLoginExceptionHandler)
+	app.Get("/admin/applications", handler.Authorize(authz.ReviewApplications), handler.GetApplicationsAdminHandler)
+	app.Post("/admin/applications/:applicationID/comments", handler.Authorize(authz.ReviewApplications), handler.RequireStepUp, handler.CommentApplicationHandler)
+	app.Post("/admin/applications/:applicationID/:decision", handler.Authorize(authz.ReviewApplications), handler.RequireStepUp, handler.ReviewApplicationHandler)
 
 	// app.Use("*", func(c *fiber.Ctx) error {
 	// 	return c.SendStatus(fiber.StatusNotFound)
@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"torospace.csudh.edu/api/entity"
+)
+
+var handleUnsafeChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// GetActivityPubActor returns the actor of an organization that opted into
+// federation.
+func (db *DB) GetActivityPubActor(userID uint) (*entity.ActivityPubActor, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	actor := &entity.ActivityPubActor{}
+	err := db.gormDB.Preload("User").First(actor, "user_id = ?", userID).Error
+	return actor, err
+}
+
+// EnableActivityPubActor opts an organization into federation, creating its
+// actor with a fresh key pair and a handle derived from the display name.
+// newKeyPair is only called when the actor has to be created.
+func (db *DB) EnableActivityPubActor(userID uint, newKeyPair func() (string, string, error)) (*entity.ActivityPubActor, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	actor := &entity.ActivityPubActor{}
+	err := db.gormDB.Preload("User").First(actor, "user_id = ?", userID).Error
+	if err == nil {
+		return actor, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	user := &entity.User{}
+	if err := db.gormDB.First(user, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	if user.Role != entity.RoleOrganization {
+		return nil, fmt.Errorf("user %d is not an organization", userID)
+	}
+
+	handle := strings.Trim(handleUnsafeChars.ReplaceAllString(strings.ToLower(user.DisplayName), "_"), "_")
+	if handle == "" {
+		handle = "org"
+	}
+	var taken int64
+	if err := db.gormDB.Model(&entity.ActivityPubActor{}).Where("handle = ?", handle).Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 {
+		handle = fmt.Sprintf("%s_%d", handle, userID)
+	}
+
+	publicKeyPem, privateKeyPem, err := newKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	actor = &entity.ActivityPubActor{
+		UserID:        userID,
+		User:          *user,
+		Handle:        handle,
+		PublicKeyPem:  publicKeyPem,
+		PrivateKeyPem: privateKeyPem,
+	}
+	return actor, db.gormDB.Omit("User").Create(actor).Error
+}
+
+// DisableActivityPubActor removes the organization's actor and keys along
+// with its followers and undelivered activities.
+func (db *DB) DisableActivityPubActor(userID uint) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.ActivityPubFollower{}).Error; err != nil {
+			return err
+		}
+		err := tx.Where("user_id = ? AND status = ?", userID, entity.ActivityPubDeliveryPending).
+			Delete(&entity.ActivityPubDelivery{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&entity.ActivityPubActor{}).Error
+	})
+}
+
+func (db *DB) GetActivityPubActorByHandle(handle string) (*entity.ActivityPubActor, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	actor := &entity.ActivityPubActor{}
+	err := db.gormDB.Preload("User").First(actor, "handle = ?", strings.ToLower(handle)).Error
+	return actor, err
+}
+
+func (db *DB) AddActivityPubFollower(follower *entity.ActivityPubFollower) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "actor_uri"}},
+		DoUpdates: clause.AssignmentColumns([]string{"inbox_url"}),
+	}).Create(follower).Error
+}
+
+func (db *DB) RemoveActivityPubFollower(userID uint, actorURI string) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Where("user_id = ? AND actor_uri = ?", userID, actorURI).Delete(&entity.ActivityPubFollower{}).Error
+}
+
+func (db *DB) CountActivityPubFollowers(userID uint) (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var count int64
+	err := db.gormDB.Model(&entity.ActivityPubFollower{}).Where("user_id = ?", userID).Count(&count).Error
+	return count, err
+}
+
+// EnqueueActivityPubDeliveries queues activity for every follower inbox of
+// the user. Followers sharing an inbox only receive it once.
+func (db *DB) EnqueueActivityPubDeliveries(userID uint, activity []byte) error {
+	db.Lock()
+	defer db.Unlock()
+
+	var inboxes []string
+	err := db.gormDB.Model(&entity.ActivityPubFollower{}).
+		Where("user_id = ?", userID).
+		Distinct().
+		Pluck("inbox_url", &inboxes).Error
+	if err != nil {
+		return err
+	}
+	return db.enqueueActivityPubDeliveries(userID, inboxes, activity)
+}
+
+func (db *DB) EnqueueActivityPubDelivery(userID uint, inbox string, activity []byte) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.enqueueActivityPubDeliveries(userID, []string{inbox}, activity)
+}
+
+func (db *DB) enqueueActivityPubDeliveries(userID uint, inboxes []string, activity []byte) error {
+	now := time.Now()
+	for _, inbox := range inboxes {
+		delivery := &entity.ActivityPubDelivery{
+			UserID:        userID,
+			InboxURL:      inbox,
+			Activity:      string(activity),
+			Status:        entity.ActivityPubDeliveryPending,
+			NextAttemptAt: now,
+		}
+		if err := db.gormDB.Create(delivery).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) GetDueActivityPubDeliveries(now time.Time, limit int) ([]*entity.ActivityPubDelivery, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var deliveries []*entity.ActivityPubDelivery
+	err := db.gormDB.
+		Where("status = ? AND next_attempt_at <= ?", entity.ActivityPubDeliveryPending, now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (db *DB) SaveActivityPubDelivery(delivery *entity.ActivityPubDelivery) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Save(delivery).Error
+}
+
+// GetPublicPostsByAuthor returns the newest visible posts of an author for
+// the ActivityPub outbox.
+func (db *DB) GetPublicPostsByAuthor(authorID uint, limit int) ([]*entity.Post, int64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	query := db.gormDB.Model(&entity.Post{}).
+		Where("author_id = ? AND hidden = ? AND visibility = ?", authorID, false, entity.VisibilityPublic)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var posts []*entity.Post
+	err := query.Preload("Author").Preload("Topics").
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&posts).Error
+	return posts, total, err
+}
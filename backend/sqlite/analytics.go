@@ -0,0 +1,137 @@
+package sqlite
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"torospace.csudh.edu/api/analytics"
+	"torospace.csudh.edu/api/entity"
+)
+
+// incrementPostStat adds views and likes to today's stats row for post.
+func incrementPostStat(tx *gorm.DB, post *entity.Post, views int64, likes int64) error {
+	stat := &entity.PostStat{
+		PostID:   post.ID,
+		Day:      time.Now().UTC().Format(analytics.DayLayout),
+		AuthorID: post.AuthorID,
+		Views:    views,
+		Likes:    likes,
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "post_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"views": gorm.Expr("views + ?", views),
+			"likes": gorm.Expr("likes + ?", likes),
+		}),
+	}).Create(stat).Error
+}
+
+// AddPostViews writes a batch of view counts keyed by post ID, to both the
+// posts' running totals and today's stats. Unknown or deleted posts are
+// skipped.
+func (db *DB) AddPostViews(counts map[uint]int64) error {
+	db.Lock()
+	defer db.Unlock()
+
+	postIDs := make([]uint, 0, len(counts))
+	for postID := range counts {
+		postIDs = append(postIDs, postID)
+	}
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		var posts []*entity.Post
+		if err := tx.Select("id", "author_id").Where("id IN ?", postIDs).Find(&posts).Error; err != nil {
+			return err
+		}
+		for _, post := range posts {
+			views := counts[post.ID]
+			err := tx.Model(&entity.Post{}).
+				Where("id = ?", post.ID).
+				UpdateColumn("views", gorm.Expr("COALESCE(views, 0) + ?", views)).Error
+			if err != nil {
+				return err
+			}
+			if err := incrementPostStat(tx, post, views, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *DB) GetPostStats(authorID uint, from time.Time, to time.Time) ([]*entity.PostStat, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var stats []*entity.PostStat
+	err := db.gormDB.
+		Where("author_id = ? AND day BETWEEN ? AND ?", authorID, from.Format(analytics.DayLayout), to.Format(analytics.DayLayout)).
+		Order("day").
+		Find(&stats).Error
+	return stats, err
+}
+
+// GetAnalyticsPosts returns the author's posts that were created between
+// from and the end of to, or that are listed in postIDs.
+func (db *DB) GetAnalyticsPosts(authorID uint, postIDs []uint, from time.Time, to time.Time) ([]*entity.Post, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var posts []*entity.Post
+	query := db.gormDB.Preload("Topics").Where("author_id = ?", authorID)
+	if len(postIDs) > 0 {
+		query = query.Where("(created_at >= ? AND created_at < ?) OR id IN ?", from, to.AddDate(0, 0, 1), postIDs)
+	} else {
+		query = query.Where("created_at >= ? AND created_at < ?", from, to.AddDate(0, 0, 1))
+	}
+	err := query.Order("created_at DESC").Find(&posts).Error
+	return posts, err
+}
+
+// GetFollowerTimes returns when each current ActivityPub follower of the
+// organization followed it, within the range.
+func (db *DB) GetFollowerTimes(organizationID uint, from time.Time, to time.Time) ([]time.Time, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var times []time.Time
+	err := db.gormDB.Model(&entity.ActivityPubFollower{}).
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", organizationID, from, to.AddDate(0, 0, 1)).
+		Pluck("created_at", &times).Error
+	return times, err
+}
+
+func (db *DB) GetMemberJoinTimes(organizationID uint, from time.Time, to time.Time) ([]time.Time, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var times []time.Time
+	err := db.gormDB.Model(&entity.OrganizationMember{}).
+		Where("organization_id = ? AND status = ?", organizationID, entity.MemberStatusActive).
+		Where("created_at >= ? AND created_at < ?", from, to.AddDate(0, 0, 1)).
+		Pluck("created_at", &times).Error
+	return times, err
+}
+
+// GetTopTopics ranks the topics of the author's posts by views and likes
+// received within the range.
+func (db *DB) GetTopTopics(authorID uint, from time.Time, to time.Time, limit int) ([]*entity.TopicStat, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var topics []*entity.TopicStat
+	err := db.gormDB.Table("post_topics").
+		Select("topics.name AS name, COUNT(DISTINCT posts.id) AS posts, COALESCE(SUM(post_stats.views), 0) AS views, COALESCE(SUM(post_stats.likes), 0) AS likes").
+		Joins("JOIN topics ON topics.id = post_topics.topic_id").
+		Joins("JOIN posts ON posts.id = post_topics.post_id AND posts.deleted_at IS NULL").
+		Joins("LEFT JOIN post_stats ON post_stats.post_id = posts.id AND post_stats.day BETWEEN ? AND ?",
+			from.Format(analytics.DayLayout), to.Format(analytics.DayLayout)).
+		Where("posts.author_id = ?", authorID).
+		Group("topics.name").
+		Order("COALESCE(SUM(post_stats.views), 0) + COALESCE(SUM(post_stats.likes), 0) DESC").
+		Order("COUNT(DISTINCT posts.id) DESC").
+		Limit(limit).
+		Scan(&topics).Error
+	return topics, err
+}
@@ -0,0 +1,147 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+func (db *DB) AddOrganizationApplication(application *entity.OrganizationApplication) error {
+	db.Lock()
+	defer db.Unlock()
+
+	var existing int64
+	err := db.gormDB.Model(&entity.User{}).
+		Where("role = ? AND LOWER(display_name) = LOWER(?)", entity.RoleOrganization, application.Name).
+		Count(&existing).Error
+	if err != nil {
+		return err
+	}
+	if existing > 0 {
+		return fmt.Errorf("organization %q already exists", application.Name)
+	}
+
+	return db.gormDB.Omit("Account").Create(application).Error
+}
+
+func (db *DB) GetOrganizationApplication(id uint) (*entity.OrganizationApplication, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	application := &entity.OrganizationApplication{}
+	err := db.gormDB.Preload("Account").Preload("Comments", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	}).First(application, "id = ?", id).Error
+	return application, err
+}
+
+func (db *DB) GetOrganizationApplications(status entity.ApplicationStatus) ([]*entity.OrganizationApplication, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	query := db.gormDB.Preload("Account").Preload("Comments", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	}).Order("created_at")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var applications []*entity.OrganizationApplication
+	err := query.Find(&applications).Error
+	return applications, err
+}
+
+func (db *DB) GetAccountApplications(accountID uint) ([]*entity.OrganizationApplication, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var applications []*entity.OrganizationApplication
+	err := db.gormDB.Preload("Comments", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("id")
+	}).Where("account_id = ?", accountID).Order("created_at DESC").Find(&applications).Error
+	return applications, err
+}
+
+func (db *DB) AddApplicationComment(comment *entity.ApplicationComment) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Create(comment).Error
+}
+
+// ReviewOrganizationApplication records the decision on a pending
+// application. Approval creates the organization user, links it to the
+// applicant's account as owner and seeds its profile, all in one transaction.
+func (db *DB) ReviewOrganizationApplication(application *entity.OrganizationApplication, reviewerAccountID uint, status entity.ApplicationStatus, comment string) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		// Guard against two admins reviewing at the same time
+		now := time.Now()
+		result := tx.Model(&entity.OrganizationApplication{}).
+			Where("id = ? AND status = ?", application.ID, entity.ApplicationPending).
+			Updates(map[string]any{
+				"status":                 status,
+				"reviewed_by_account_id": reviewerAccountID,
+				"reviewed_at":            now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("application %d is not pending", application.ID)
+		}
+		application.Status = status
+		application.ReviewedByAccountID = reviewerAccountID
+		application.ReviewedAt = &now
+
+		if comment != "" {
+			newComment := entity.ApplicationComment{
+				ApplicationID: application.ID,
+				AccountID:     reviewerAccountID,
+				Body:          comment,
+			}
+			if err := tx.Create(&newComment).Error; err != nil {
+				return err
+			}
+			application.Comments = append(application.Comments, newComment)
+		}
+
+		if status != entity.ApplicationApproved {
+			return nil
+		}
+
+		organization := &entity.User{
+			DisplayName: application.Name,
+			Role:        entity.RoleOrganization,
+			Profile: &entity.OrganizationProfile{
+				Description: application.Description,
+				SocialLinks: []entity.SocialLink{},
+			},
+		}
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+		owner := &entity.OrganizationMember{
+			OrganizationID:     organization.ID,
+			AccountID:          application.AccountID,
+			Role:               entity.MemberRoleOwner,
+			Status:             entity.MemberStatusActive,
+			InvitedByAccountID: reviewerAccountID,
+		}
+		if err := tx.Omit("Account").Create(owner).Error; err != nil {
+			return err
+		}
+		if err := syncPersona(tx, owner, true); err != nil {
+			return err
+		}
+
+		application.OrganizationID = organization.ID
+		return tx.Model(&entity.OrganizationApplication{}).
+			Where("id = ?", application.ID).
+			Update("organization_id", organization.ID).Error
+	})
+}
@@ -0,0 +1,22 @@
+package sqlite
+
+import "torospace.csudh.edu/api/entity"
+
+func (db *DB) AddAuditEntry(entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Create(entry).Error
+}
+
+func (db *DB) GetAuditEntries(subjectType string, subjectID uint) ([]*entity.AuditEntry, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var entries []*entity.AuditEntry
+	err := db.gormDB.
+		Where("subject_type = ? AND subject_id = ?", subjectType, subjectID).
+		Order("id DESC").
+		Find(&entries).Error
+	return entries, err
+}
@@ -0,0 +1,61 @@
+package sqlite
+
+import (
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+// seedCategories creates the default categories on an empty table.
+func (db *DB) seedCategories() error {
+	var count int64
+	if err := db.gormDB.Model(&entity.Category{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	categories := make([]entity.Category, len(entity.DefaultCategories))
+	copy(categories, entity.DefaultCategories)
+	return db.gormDB.Create(&categories).Error
+}
+
+func (db *DB) GetCategories() ([]*entity.Category, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var categories []*entity.Category
+	err := db.gormDB.Order("name").Find(&categories).Error
+	return categories, err
+}
+
+func (db *DB) GetCategory(slug string) (*entity.Category, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	category := &entity.Category{}
+	err := db.gormDB.First(category, "slug = ?", slug).Error
+	return category, err
+}
+
+func (db *DB) AddCategory(category *entity.Category) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Create(category).Error
+}
+
+// DeleteCategory removes a category and clears it from every profile using it.
+func (db *DB) DeleteCategory(category *entity.Category) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.OrganizationProfile{}).
+			Where("category = ?", category.Slug).
+			Update("category", "").Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&entity.Category{}, category.ID).Error
+	})
+}
@@ -0,0 +1,90 @@
+package sqlite
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"torospace.csudh.edu/api/entity"
+)
+
+// preloadCoauthors loads the accepted co-authors of the posts in query.
+func preloadCoauthors(query *gorm.DB) *gorm.DB {
+	return query.
+		Preload("Coauthors", "status = ?", entity.CoauthorAccepted).
+		Preload("Coauthors.Organization")
+}
+
+// coauthoredPostIDs selects the posts an organization accepted to co-author.
+func (db *DB) coauthoredPostIDs(organizationID uint) *gorm.DB {
+	return db.gormDB.
+		Model(&entity.PostCoauthor{}).
+		Select("post_id").
+		Where("organization_id = ? AND status = ?", organizationID, entity.CoauthorAccepted)
+}
+
+func (db *DB) GetPostCoauthor(postID uint, organizationID uint) (*entity.PostCoauthor, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	coauthor := &entity.PostCoauthor{}
+	err := db.gormDB.Preload("Organization").
+		First(coauthor, "post_id = ? AND organization_id = ?", postID, organizationID).Error
+	return coauthor, err
+}
+
+// GetCoauthorInvites returns the posts an organization was invited to
+// co-author and has not answered yet.
+func (db *DB) GetCoauthorInvites(organizationID uint) ([]*entity.PostCoauthor, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var coauthors []*entity.PostCoauthor
+	err := db.gormDB.Preload("Post").Preload("Post.Author").
+		Where("organization_id = ? AND status = ?", organizationID, entity.CoauthorInvited).
+		Order("id").
+		Find(&coauthors).Error
+	return coauthors, err
+}
+
+func (db *DB) AddPostCoauthor(coauthor *entity.PostCoauthor) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Omit(clause.Associations).Create(coauthor).Error
+}
+
+func (db *DB) SavePostCoauthor(coauthor *entity.PostCoauthor) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Omit(clause.Associations).Save(coauthor).Error
+}
+
+func (db *DB) RemovePostCoauthor(coauthor *entity.PostCoauthor) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Delete(&entity.PostCoauthor{}, coauthor.ID).Error
+}
+
+// UpdatePost replaces the content, visibility and topics of a post.
+func (db *DB) UpdatePost(post *entity.Post, content string, visibility entity.Visibility, topics []entity.Topic) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(post).Omit(clause.Associations).Updates(map[string]any{
+			"content":    content,
+			"visibility": visibility,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(post).Association("Topics").Replace(topics); err != nil {
+			return err
+		}
+		post.Content = content
+		post.Visibility = visibility
+		post.Topics = topics
+		return nil
+	})
+}
@@ -0,0 +1,156 @@
+package sqlite
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+func (db *DB) GetAccountDeletion(accountID uint) (*entity.AccountDeletion, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	deletion := &entity.AccountDeletion{}
+	err := db.gormDB.First(deletion, "account_id = ?", accountID).Error
+	return deletion, err
+}
+
+func (db *DB) AddAccountDeletion(deletion *entity.AccountDeletion, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(deletion).Error; err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+func (db *DB) CancelAccountDeletion(deletion *entity.AccountDeletion, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(deletion).Error; err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+func (db *DB) GetDueAccountDeletions(now time.Time) ([]*entity.AccountDeletion, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var deletions []*entity.AccountDeletion
+	err := db.gormDB.Where("scheduled_for <= ?", now).Order("scheduled_for").Find(&deletions).Error
+	return deletions, err
+}
+
+// GetSoleOwnedOrganizations returns the organizations the account is the
+// only active owner of, whether or not anyone else is a member. Deleting the
+// account would leave them without an owner.
+func (db *DB) GetSoleOwnedOrganizations(accountID uint) ([]*entity.User, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var organizations []*entity.User
+	err := db.gormDB.
+		Joins("JOIN organization_members m ON m.organization_id = users.id").
+		Where("m.account_id = ? AND m.role = ? AND m.status = ?", accountID, entity.MemberRoleOwner, entity.MemberStatusActive).
+		Where("NOT EXISTS (SELECT 1 FROM organization_members o WHERE o.organization_id = users.id AND o.account_id != ? AND o.role = ? AND o.status = ?)",
+			accountID, entity.MemberRoleOwner, entity.MemberStatusActive).
+		Order("users.id").
+		Find(&organizations).Error
+	return organizations, err
+}
+
+// DeleteAccountData erases an account. Student personas only the account
+// uses are deleted with their likes; shared organization personas and what
+// they posted stay. Audit entries stay, keyed by the old account ID.
+func (db *DB) DeleteAccountData(accountID uint, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		account := &entity.Account{}
+		if err := tx.Preload("Users").First(account, "id = ?", accountID).Error; err != nil {
+			return err
+		}
+
+		for _, user := range account.Users {
+			if user.Role != entity.RoleStudent {
+				continue
+			}
+			var shared int64
+			err := tx.Table("account_users").Where("user_id = ? AND account_id != ?", user.ID, accountID).Count(&shared).Error
+			if err != nil {
+				return err
+			}
+			if shared > 0 {
+				continue
+			}
+			var likedPostIDs []uint
+			if err := tx.Table("post_users").Where("user_id = ?", user.ID).Pluck("post_id", &likedPostIDs).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM post_users WHERE user_id = ?", user.ID).Error; err != nil {
+				return err
+			}
+			err = tx.Exec("UPDATE posts SET likes = (SELECT COUNT(*) FROM post_users WHERE post_users.post_id = posts.id) WHERE id IN ?", likedPostIDs).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Delete(&entity.User{}, user.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		var subscriptionIDs []uint
+		err := tx.Model(&entity.DigestSubscription{}).Where("account_id = ?", accountID).Pluck("id", &subscriptionIDs).Error
+		if err != nil {
+			return err
+		}
+		statements := []struct {
+			sql  string
+			args []any
+		}{
+			{"DELETE FROM account_users WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM organization_members WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM account_identities WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM sessions WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM access_tokens WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM two_factors WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM recovery_codes WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM digest_organizations WHERE digest_subscription_id IN ?", []any{subscriptionIDs}},
+			{"DELETE FROM digest_topics WHERE digest_subscription_id IN ?", []any{subscriptionIDs}},
+			{"DELETE FROM digest_subscriptions WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM application_comments WHERE application_id IN (SELECT id FROM organization_applications WHERE account_id = ?)", []any{accountID}},
+			{"DELETE FROM organization_applications WHERE account_id = ?", []any{accountID}},
+			{"DELETE FROM login_exceptions WHERE email = LOWER(?)", []any{account.Email}},
+			{"DELETE FROM account_deletions WHERE account_id = ?", []any{accountID}},
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement.sql, statement.args...).Error; err != nil {
+				return err
+			}
+		}
+
+		err = tx.Model(&entity.OwnershipTransfer{}).
+			Where("(from_account_id = ? OR to_account_id = ?) AND status = ?", accountID, accountID, entity.TransferPending).
+			Updates(map[string]any{
+				"status":      entity.TransferCancelled,
+				"resolved_at": time.Now(),
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&entity.Account{}, accountID).Error; err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
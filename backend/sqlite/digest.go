@@ -0,0 +1,181 @@
+package sqlite
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"torospace.csudh.edu/api/entity"
+)
+
+type TopPostsParams struct {
+	Since           time.Time
+	OrganizationIDs []uint
+	TopicIDs        []uint
+	Limit           int
+	Audience        PostAudience
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// GetDigestSubscription returns the digest settings for an account, creating
+// an enabled subscription the first time the account is seen.
+func (db *DB) GetDigestSubscription(accountID uint) (*entity.DigestSubscription, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.getDigestSubscription(accountID)
+}
+
+func (db *DB) getDigestSubscription(accountID uint) (*entity.DigestSubscription, error) {
+	subscription := &entity.DigestSubscription{}
+	err := db.gormDB.Preload("Organizations").Preload("Topics").
+		Where("account_id = ?", accountID).
+		Limit(1).
+		Find(subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	if subscription.ID != 0 {
+		return subscription, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	subscription = &entity.DigestSubscription{
+		AccountID:        accountID,
+		Enabled:          true,
+		UnsubscribeToken: token,
+	}
+	return subscription, db.gormDB.Create(subscription).Error
+}
+
+func (db *DB) UpdateDigestSubscription(subscription *entity.DigestSubscription, organizationIDs []uint, topicIDs []uint) error {
+	db.Lock()
+	defer db.Unlock()
+
+	organizations := []entity.User{}
+	if len(organizationIDs) > 0 {
+		if err := db.gormDB.Where("id IN ? AND role = ?", organizationIDs, entity.RoleOrganization).Find(&organizations).Error; err != nil {
+			return err
+		}
+		if len(organizations) != len(organizationIDs) {
+			return fmt.Errorf("unknown organization in %v", organizationIDs)
+		}
+	}
+
+	topics := []entity.Topic{}
+	if len(topicIDs) > 0 {
+		if err := db.gormDB.Where("id IN ?", topicIDs).Find(&topics).Error; err != nil {
+			return err
+		}
+		if len(topics) != len(topicIDs) {
+			return fmt.Errorf("unknown topic in %v", topicIDs)
+		}
+	}
+
+	if err := db.gormDB.Model(subscription).Update("enabled", subscription.Enabled).Error; err != nil {
+		return err
+	}
+	if err := db.gormDB.Model(subscription).Association("Organizations").Replace(organizations); err != nil {
+		return err
+	}
+	return db.gormDB.Model(subscription).Association("Topics").Replace(topics)
+}
+
+func (db *DB) UnsubscribeDigest(token string) error {
+	db.Lock()
+	defer db.Unlock()
+
+	result := db.gormDB.Model(&entity.DigestSubscription{}).
+		Where("unsubscribe_token = ?", token).
+		Update("enabled", false)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("no subscription for token")
+	}
+	return nil
+}
+
+// GetDueDigestAccounts returns the accounts with an enabled digest that has
+// not been sent since before.
+func (db *DB) GetDueDigestAccounts(before time.Time) ([]*entity.Account, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	// Make sure every account has a subscription before picking the due ones
+	var missing []uint
+	err := db.gormDB.Model(&entity.Account{}).
+		Where("id NOT IN (?)", db.gormDB.Model(&entity.DigestSubscription{}).Select("account_id")).
+		Pluck("id", &missing).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, accountID := range missing {
+		if _, err := db.getDigestSubscription(accountID); err != nil {
+			return nil, err
+		}
+	}
+
+	var accounts []*entity.Account
+	err = db.gormDB.
+		Joins("JOIN digest_subscriptions ON digest_subscriptions.account_id = accounts.id").
+		Where("digest_subscriptions.enabled = ?", true).
+		Where("digest_subscriptions.last_sent_at IS NULL OR digest_subscriptions.last_sent_at < ?", before).
+		Find(&accounts).Error
+	return accounts, err
+}
+
+func (db *DB) MarkDigestSent(subscription *entity.DigestSubscription, sentAt time.Time) error {
+	db.Lock()
+	defer db.Unlock()
+
+	subscription.LastSentAt = &sentAt
+	return db.gormDB.Model(subscription).Update("last_sent_at", sentAt).Error
+}
+
+// GetTopPosts returns the most liked visible posts since params.Since. When
+// organizations or topics are given, only posts by one of the organizations
+// or tagged with one of the topics are considered.
+func (db *DB) GetTopPosts(params *TopPostsParams) ([]*entity.Post, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	if params.Limit <= 0 {
+		params.Limit = 10
+	}
+
+	query := db.gormDB.Model(&entity.Post{}).Preload("Author").Preload("Topics").
+		Where("hidden = ?", false).
+		Where("created_at >= ?", params.Since).
+		Order("likes DESC").
+		Order("created_at DESC")
+	query = db.visibleTo(query, params.Audience)
+
+	if len(params.OrganizationIDs) > 0 || len(params.TopicIDs) > 0 {
+		var matchingByTopic []uint64
+		if len(params.TopicIDs) > 0 {
+			db.gormDB.
+				Table("post_topics").
+				Where("topic_id IN ?", params.TopicIDs).
+				Distinct().
+				Pluck("post_id", &matchingByTopic)
+		}
+		query = query.Where("(author_id IN (?)) OR (posts.id IN (?))", params.OrganizationIDs, matchingByTopic)
+	}
+
+	var posts []*entity.Post
+	err := query.Limit(params.Limit).Find(&posts).Error
+	return posts, err
+}
@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+func (db *DB) GetLoginExceptions() ([]*entity.LoginException, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var exceptions []*entity.LoginException
+	err := db.gormDB.Order("email").Find(&exceptions).Error
+	return exceptions, err
+}
+
+func (db *DB) GetLoginException(id uint) (*entity.LoginException, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	exception := &entity.LoginException{}
+	err := db.gormDB.First(exception, "id = ?", id).Error
+	return exception, err
+}
+
+// GetLoginExceptionByEmail looks up the exception for an email, ignoring case.
+func (db *DB) GetLoginExceptionByEmail(email string) (*entity.LoginException, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	exception := &entity.LoginException{}
+	err := db.gormDB.First(exception, "email = LOWER(?)", email).Error
+	return exception, err
+}
+
+func (db *DB) AddLoginException(exception *entity.LoginException, auditEntry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(exception).Error; err != nil {
+			return err
+		}
+		auditEntry.SubjectID = exception.ID
+		return tx.Create(auditEntry).Error
+	})
+}
+
+func (db *DB) DeleteLoginException(exception *entity.LoginException, auditEntry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(exception).Error; err != nil {
+			return err
+		}
+		return tx.Create(auditEntry).Error
+	})
+}
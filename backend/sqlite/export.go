@@ -0,0 +1,119 @@
+package sqlite
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+// PostLike is a like given through one of the account's personas.
+type PostLike struct {
+	PostID uint `json:"post_id"`
+	UserID uint `json:"user_id"`
+}
+
+// AccountExport is everything stored about an account, for its owner to
+// download. Secrets such as token hashes are left out by the entities' JSON.
+type AccountExport struct {
+	ExportedAt         time.Time                         `json:"exported_at"`
+	Account            *entity.Account                   `json:"account"`
+	Identities         []*entity.AccountIdentity         `json:"identities"`
+	Sessions           []*entity.Session                 `json:"sessions"`
+	AccessTokens       []*entity.AccessToken             `json:"access_tokens"`
+	TwoFactor          *entity.TwoFactor                 `json:"two_factor"`
+	RecoveryCodes      []*entity.RecoveryCode            `json:"recovery_codes"`
+	StaffGrant         *entity.StaffGrant                `json:"staff_grant"`
+	Memberships        []*entity.OrganizationMember      `json:"memberships"`
+	Applications       []*entity.OrganizationApplication `json:"applications"`
+	OwnershipTransfers []*entity.OwnershipTransfer       `json:"ownership_transfers"`
+	DigestSubscription *entity.DigestSubscription        `json:"digest_subscription"`
+	Likes              []*PostLike                       `json:"likes"`
+	Impersonations     []*entity.Impersonation           `json:"impersonations"`
+	AuditEntries       []*entity.AuditEntry              `json:"audit_entries"`
+	Deletion           *entity.AccountDeletion           `json:"deletion"`
+}
+
+// findOptional is Find into a single record, leaving it nil when there is
+// none.
+func findOptional[T any](query *gorm.DB) (*T, error) {
+	var records []*T
+	if err := query.Limit(1).Find(&records).Error; err != nil || len(records) == 0 {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+func (db *DB) GetAccountExport(accountID uint) (*AccountExport, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	export := &AccountExport{
+		ExportedAt: time.Now(),
+		Account:    &entity.Account{},
+	}
+	err := db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Users").First(export.Account, "id = ?", accountID).Error; err != nil {
+			return err
+		}
+		userIDs := make([]uint, len(export.Account.Users))
+		for i, user := range export.Account.Users {
+			userIDs[i] = user.ID
+		}
+
+		var err error
+		if err = tx.Where("account_id = ?", accountID).Order("id").Find(&export.Identities).Error; err != nil {
+			return err
+		}
+		if err = tx.Where("account_id = ?", accountID).Order("id").Find(&export.Sessions).Error; err != nil {
+			return err
+		}
+		if err = tx.Where("account_id = ?", accountID).Order("id").Find(&export.AccessTokens).Error; err != nil {
+			return err
+		}
+		if export.TwoFactor, err = findOptional[entity.TwoFactor](tx.Where("account_id = ?", accountID)); err != nil {
+			return err
+		}
+		if err = tx.Where("account_id = ?", accountID).Order("id").Find(&export.RecoveryCodes).Error; err != nil {
+			return err
+		}
+		if export.StaffGrant, err = findOptional[entity.StaffGrant](tx.Where("account_id = ?", accountID)); err != nil {
+			return err
+		}
+		if err = tx.Where("account_id = ?", accountID).Order("id").Find(&export.Memberships).Error; err != nil {
+			return err
+		}
+		err = tx.Preload("Comments", func(tx *gorm.DB) *gorm.DB {
+			return tx.Order("id")
+		}).Where("account_id = ?", accountID).Order("id").Find(&export.Applications).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("from_account_id = ? OR to_account_id = ? OR initiated_by_account_id = ?", accountID, accountID, accountID).
+			Order("id").Find(&export.OwnershipTransfers).Error
+		if err != nil {
+			return err
+		}
+		export.DigestSubscription, err = findOptional[entity.DigestSubscription](
+			tx.Preload("Organizations").Preload("Topics").Where("account_id = ?", accountID))
+		if err != nil {
+			return err
+		}
+		err = tx.Table("post_users").Select("post_id, user_id").
+			Where("user_id IN ?", userIDs).Order("post_id").Scan(&export.Likes).Error
+		if err != nil {
+			return err
+		}
+		if err = tx.Where("account_id = ?", accountID).Order("id").Find(&export.Impersonations).Error; err != nil {
+			return err
+		}
+		err = tx.Where("actor_account_id = ? OR (subject_type = ? AND subject_id = ?)", accountID, "account", accountID).
+			Order("id").Find(&export.AuditEntries).Error
+		if err != nil {
+			return err
+		}
+		export.Deletion, err = findOptional[entity.AccountDeletion](tx.Where("account_id = ?", accountID))
+		return err
+	})
+	return export, err
+}
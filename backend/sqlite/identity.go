@@ -0,0 +1,100 @@
+package sqlite
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+// backfillAccountIdentities links accounts created by the Google only login,
+// which kept the Google ID on the account row, to a google identity.
+func (db *DB) backfillAccountIdentities() error {
+	if !db.gormDB.Migrator().HasColumn(&entity.Account{}, "google_id") {
+		return nil
+	}
+
+	var accounts []struct {
+		ID       uint
+		Email    string
+		GoogleID string
+	}
+	err := db.gormDB.Table("accounts").
+		Select("id, email, google_id").
+		Where("google_id IS NOT NULL AND google_id != ''").
+		Where("NOT EXISTS (SELECT 1 FROM account_identities WHERE account_identities.provider = 'google' AND account_identities.subject = accounts.google_id)").
+		Scan(&accounts).Error
+	if err != nil {
+		return err
+	}
+	for _, a := range accounts {
+		accountIdentity := &entity.AccountIdentity{
+			AccountID: a.ID,
+			Provider:  "google",
+			Subject:   a.GoogleID,
+			Email:     a.Email,
+		}
+		if err := db.gormDB.Create(accountIdentity).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoginAccountIdentity returns the account linked to the identity. An
+// identity seen for the first time is linked to the account with the same
+// email when linkByEmail is set, otherwise newAccount is created.
+func (db *DB) LoginAccountIdentity(accountIdentity *entity.AccountIdentity, linkByEmail bool, newAccount *entity.Account) (*entity.Account, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	account := &entity.Account{}
+	err := db.gormDB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		existing := &entity.AccountIdentity{}
+		err := tx.First(existing, "provider = ? AND subject = ?", accountIdentity.Provider, accountIdentity.Subject).Error
+		if err == nil {
+			err := tx.Model(existing).Updates(map[string]any{
+				"email":         accountIdentity.Email,
+				"last_login_at": now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			*accountIdentity = *existing
+			return tx.First(account, "id = ?", accountIdentity.AccountID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		err = gorm.ErrRecordNotFound
+		if linkByEmail && accountIdentity.Email != "" {
+			err = tx.First(account, "LOWER(email) = LOWER(?)", accountIdentity.Email).Error
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := tx.Create(newAccount).Error; err != nil {
+				return err
+			}
+			account = newAccount
+		} else if err != nil {
+			return err
+		}
+
+		accountIdentity.AccountID = account.ID
+		accountIdentity.LastLoginAt = &now
+		return tx.Create(accountIdentity).Error
+	})
+	return account, err
+}
+
+func (db *DB) GetAccountIdentities(accountID uint) ([]*entity.AccountIdentity, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var identities []*entity.AccountIdentity
+	err := db.gormDB.Where("account_id = ?", accountID).Order("provider").Find(&identities).Error
+	return identities, err
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+func (db *DB) AddImpersonation(impersonation *entity.Impersonation, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(impersonation).Error; err != nil {
+			return err
+		}
+		entry.SubjectID = impersonation.ID
+		return tx.Create(entry).Error
+	})
+}
+
+func (db *DB) GetImpersonation(id uint) (*entity.Impersonation, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	impersonation := &entity.Impersonation{}
+	err := db.gormDB.First(impersonation, "id = ?", id).Error
+	return impersonation, err
+}
+
+// GetImpersonations lists the most recent impersonations first.
+func (db *DB) GetImpersonations(limit int) ([]*entity.Impersonation, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var impersonations []*entity.Impersonation
+	err := db.gormDB.Order("id DESC").Limit(limit).Find(&impersonations).Error
+	return impersonations, err
+}
+
+// EndImpersonation records when the impersonation ended, once.
+func (db *DB) EndImpersonation(impersonation *entity.Impersonation, endedAt time.Time, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(impersonation).Where("ended_at IS NULL").Update("ended_at", endedAt)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Create(entry).Error
+	})
+}
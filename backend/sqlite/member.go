@@ -0,0 +1,181 @@
+package sqlite
+
+import (
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+// syncPersona links or unlinks the organization persona on the member's
+// account so that only active owners and officers can select it.
+func syncPersona(tx *gorm.DB, member *entity.OrganizationMember, linked bool) error {
+	association := tx.Model(&entity.Account{ID: member.AccountID}).Association("Users")
+	if linked {
+		return association.Append(&entity.User{ID: member.OrganizationID})
+	}
+	return association.Delete(&entity.User{ID: member.OrganizationID})
+}
+
+func memberLinked(member *entity.OrganizationMember) bool {
+	return member.Status == entity.MemberStatusActive && member.Role.CanActAsOrganization()
+}
+
+// backfillOrganizationOwners makes every account already linked to an
+// organization persona its owner, for data created before memberships.
+func (db *DB) backfillOrganizationOwners() error {
+	type link struct {
+		AccountID uint
+		UserID    uint
+	}
+	var links []link
+	err := db.gormDB.Table("account_users").
+		Select("account_users.account_id, account_users.user_id").
+		Joins("JOIN users ON users.id = account_users.user_id").
+		Where("users.role = ?", entity.RoleOrganization).
+		Where("NOT EXISTS (SELECT 1 FROM organization_members WHERE organization_members.organization_id = account_users.user_id AND organization_members.account_id = account_users.account_id)").
+		Scan(&links).Error
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		member := &entity.OrganizationMember{
+			OrganizationID: l.UserID,
+			AccountID:      l.AccountID,
+			Role:           entity.MemberRoleOwner,
+			Status:         entity.MemberStatusActive,
+		}
+		if err := db.gormDB.Create(member).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) GetAccountByEmail(email string) (*entity.Account, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	account := &entity.Account{}
+	err := db.gormDB.First(account, "email = ?", email).Error
+	return account, err
+}
+
+func (db *DB) GetOrganizationMember(organizationID uint, accountID uint) (*entity.OrganizationMember, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	member := &entity.OrganizationMember{}
+	err := db.gormDB.Preload("Account").
+		First(member, "organization_id = ? AND account_id = ?", organizationID, accountID).Error
+	return member, err
+}
+
+func (db *DB) GetOrganizationMembers(organizationID uint) ([]*entity.OrganizationMember, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var members []*entity.OrganizationMember
+	err := db.gormDB.Preload("Account").
+		Where("organization_id = ?", organizationID).
+		Order("id").
+		Find(&members).Error
+	return members, err
+}
+
+func (db *DB) GetAccountMemberships(accountID uint, status entity.MemberStatus) ([]*entity.OrganizationMember, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var members []*entity.OrganizationMember
+	err := db.gormDB.
+		Where("account_id = ? AND status = ?", accountID, status).
+		Order("id").
+		Find(&members).Error
+	return members, err
+}
+
+func (db *DB) CountOrganizationOwners(organizationID uint) (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var count int64
+	err := db.gormDB.Model(&entity.OrganizationMember{}).
+		Where("organization_id = ? AND role = ? AND status = ?", organizationID, entity.MemberRoleOwner, entity.MemberStatusActive).
+		Count(&count).Error
+	return count, err
+}
+
+func (db *DB) AddOrganizationMember(member *entity.OrganizationMember) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Account").Create(member).Error; err != nil {
+			return err
+		}
+		if memberLinked(member) {
+			return syncPersona(tx, member, true)
+		}
+		return nil
+	})
+}
+
+// SaveOrganizationMember stores a role or status change and updates access to
+// the organization persona to match.
+func (db *DB) SaveOrganizationMember(member *entity.OrganizationMember) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Account").Save(member).Error; err != nil {
+			return err
+		}
+		return syncPersona(tx, member, memberLinked(member))
+	})
+}
+
+func (db *DB) RemoveOrganizationMember(member *entity.OrganizationMember) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&entity.OrganizationMember{}, member.ID).Error; err != nil {
+			return err
+		}
+		return syncPersona(tx, member, false)
+	})
+}
+
+// fillMemberCounts sets MemberCount on each organization to its number of
+// active members of any role.
+func fillMemberCounts(tx *gorm.DB, organizations []*entity.User) error {
+	if len(organizations) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(organizations))
+	for _, organization := range organizations {
+		ids = append(ids, organization.ID)
+	}
+
+	var counts []struct {
+		OrganizationID uint
+		Count          int64
+	}
+	err := tx.Model(&entity.OrganizationMember{}).
+		Select("organization_id, COUNT(*) AS count").
+		Where("organization_id IN ? AND status = ?", ids, entity.MemberStatusActive).
+		Group("organization_id").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	byOrganization := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		byOrganization[count.OrganizationID] = count.Count
+	}
+	for _, organization := range organizations {
+		count := byOrganization[organization.ID]
+		organization.MemberCount = &count
+	}
+	return nil
+}
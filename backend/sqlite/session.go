@@ -0,0 +1,143 @@
+package sqlite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"torospace.csudh.edu/api/entity"
+)
+
+// noExpiry stands in for sessions stored without an expiration.
+const noExpiry = 100 * 365 * 24 * time.Hour
+
+// SessionKeyHash is how a session ID or access token is stored and looked up.
+func SessionKeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// SessionStorage keeps Fiber sessions in the sessions table. It implements
+// fiber.Storage.
+type SessionStorage struct {
+	db *DB
+}
+
+func (db *DB) SessionStorage() *SessionStorage {
+	return &SessionStorage{db: db}
+}
+
+func (s *SessionStorage) Get(key string) ([]byte, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	session := &entity.Session{}
+	err := s.db.gormDB.Select("data").
+		First(session, "key_hash = ? AND expires_at > ?", SessionKeyHash(key), time.Now()).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return session.Data, err
+}
+
+func (s *SessionStorage) Set(key string, val []byte, exp time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+	if exp <= 0 {
+		exp = noExpiry
+	}
+
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	now := time.Now()
+	session := &entity.Session{
+		KeyHash:    SessionKeyHash(key),
+		Data:       val,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(exp),
+	}
+	return s.db.gormDB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key_hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data", "last_seen_at", "expires_at"}),
+	}).Create(session).Error
+}
+
+func (s *SessionStorage) Delete(key string) error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	return s.db.gormDB.Where("key_hash = ?", SessionKeyHash(key)).Delete(&entity.Session{}).Error
+}
+
+func (s *SessionStorage) Reset() error {
+	s.db.Lock()
+	defer s.db.Unlock()
+
+	return s.db.gormDB.Where("1 = 1").Delete(&entity.Session{}).Error
+}
+
+func (s *SessionStorage) Close() error {
+	return nil
+}
+
+// SetSessionAccount records who logged in to a session and from where.
+func (db *DB) SetSessionAccount(key string, accountID uint, userAgent string, ip string) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Model(&entity.Session{}).
+		Where("key_hash = ?", SessionKeyHash(key)).
+		Updates(map[string]any{
+			"account_id": accountID,
+			"user_agent": userAgent,
+			"ip":         ip,
+		}).Error
+}
+
+func (db *DB) GetAccountSessions(accountID uint) ([]*entity.Session, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var sessions []*entity.Session
+	err := db.gormDB.Omit("data").
+		Where("account_id = ? AND expires_at > ?", accountID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// DeleteAccountSession revokes one of the account's sessions.
+func (db *DB) DeleteAccountSession(accountID uint, id uint) (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	result := db.gormDB.Where("account_id = ? AND id = ?", accountID, id).Delete(&entity.Session{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteAccountSessions revokes every session of the account except the
+// one with keepKeyHash, if given.
+func (db *DB) DeleteAccountSessions(accountID uint, keepKeyHash string) (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	query := db.gormDB.Where("account_id = ?", accountID)
+	if keepKeyHash != "" {
+		query = query.Where("key_hash != ?", keepKeyHash)
+	}
+	result := query.Delete(&entity.Session{})
+	return result.RowsAffected, result.Error
+}
+
+func (db *DB) DeleteExpiredSessions() (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	result := db.gormDB.Where("expires_at <= ?", time.Now()).Delete(&entity.Session{})
+	return result.RowsAffected, result.Error
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"torospace.csudh.edu/api/entity"
 )
 
@@ -15,7 +17,10 @@ type PostParams struct {
 	After       string `json:"after"`
 	PageSize    int    `json:"page_size"`
 	SearchQuery string `json:"search_query"`
+	TopicName   string `json:"topic_name"`
 	GetHidden   bool   `json:"get_hidden"`
+	// Audience limits results to posts the reader may see
+	Audience PostAudience `json:"-"`
 }
 
 type PostsResult struct {
@@ -25,16 +30,38 @@ type PostsResult struct {
 	HasAfter  bool           `json:"has_after"`
 }
 
+type OrganizationSort string
+
+var (
+	OrganizationSortAlphabetical OrganizationSort = "alphabetical"
+	OrganizationSortNewest       OrganizationSort = "newest"
+	OrganizationSortMostActive   OrganizationSort = "most_active"
+)
+
+// organizationActivityDays is the window used to rank organizations by
+// recent posts.
+const organizationActivityDays = 30
+
+// OrganizationParams filters and sorts the organization directory. Without a
+// Sort, results are newest first and paged with Before and After; with one,
+// they are paged with Page.
 type OrganizationParams struct {
-	Before      string `json:"before"`
-	After       string `json:"after"`
-	PageSize    int    `json:"page_size"`
-	SearchQuery string `json:"search_query"`
+	Before           string           `json:"before"`
+	After            string           `json:"after"`
+	Page             int              `json:"page"`
+	PageSize         int              `json:"page_size"`
+	SearchQuery      string           `json:"search_query"`
+	Category         string           `json:"category"`
+	Verified         *bool            `json:"verified"`
+	MinMembers       int              `json:"min_members"`
+	ActiveWithinDays int              `json:"active_within_days"`
+	Sort             OrganizationSort `json:"sort"`
 }
 
 type OrganizationsResult struct {
 	Organizations []*entity.User `json:"organizations"`
 	Count         int            `json:"count"`
+	Page          int            `json:"page,omitempty"`
 	HasBefore     bool           `json:"has_before"`
 	HasAfter      bool           `json:"has_after"`
 }
@@ -65,10 +92,48 @@ func NewDB() (*DB, error) {
 	}
 
 	db.AutoMigrate(&entity.Account{})
+	db.AutoMigrate(&entity.AccountIdentity{})
+	db.AutoMigrate(&entity.LoginException{})
+	db.AutoMigrate(&entity.Session{})
+	db.AutoMigrate(&entity.AccessToken{})
+	db.AutoMigrate(&entity.StaffGrant{})
+	db.AutoMigrate(&entity.Impersonation{})
+	db.AutoMigrate(&entity.AccountDeletion{})
+	db.AutoMigrate(&entity.TwoFactor{})
+	db.AutoMigrate(&entity.RecoveryCode{})
 	db.AutoMigrate(&entity.User{})
+	db.AutoMigrate(&entity.OrganizationProfile{})
+	db.AutoMigrate(&entity.Category{})
+	db.AutoMigrate(&entity.OrganizationMember{})
+	db.AutoMigrate(&entity.OrganizationApplication{})
+	db.AutoMigrate(&entity.ApplicationComment{})
+	db.AutoMigrate(&entity.OwnershipTransfer{})
+	db.AutoMigrate(&entity.AuditEntry{})
 	db.AutoMigrate(&entity.Post{})
 	db.AutoMigrate(&entity.Topic{})
-	return &DB{gormDB: db}, nil
+	db.AutoMigrate(&entity.PostCoauthor{})
+	db.AutoMigrate(&entity.PostStat{})
+	db.AutoMigrate(&entity.DigestSubscription{})
+	db.AutoMigrate(&entity.Webhook{})
+	db.AutoMigrate(&entity.WebhookDelivery{})
+	db.AutoMigrate(&entity.ActivityPubActor{})
+	db.AutoMigrate(&entity.ActivityPubFollower{})
+	db.AutoMigrate(&entity.ActivityPubDelivery{})
+
+	newDB := &DB{gormDB: db}
+	if err := newDB.backfillOrganizationOwners(); err != nil {
+		return nil, err
+	}
+	if err := newDB.seedCategories(); err != nil {
+		return nil, err
+	}
+	if err := newDB.backfillAccountIdentities(); err != nil {
+		return nil, err
+	}
+	if err := newDB.backfillStaffGrants(); err != nil {
+		return nil, err
+	}
+	return newDB, nil
 }
 
 func (db *DB) AddAccount(account *entity.Account) error {
@@ -83,7 +148,12 @@ func (db *DB) AddAccountUser(account *entity.Account, user *entity.User) error {
 	defer db.Unlock()
 
 	account.Users = append(account.Users, *user)
-	return db.gormDB.Save(account).Error
+	if err := db.gormDB.Save(account).Error; err != nil {
+		return err
+	}
+	// Save assigns the ID to the copy in account.Users
+	*user = account.Users[len(account.Users)-1]
+	return nil
 }
 
 func (db *DB) GetAccountByID(id uint) (*entity.Account, error) {
@@ -95,15 +165,6 @@ func (db *DB) GetAccountByID(id uint) (*entity.Account, error) {
 	return account, err
 }
 
-func (db *DB) GetAccountByGoogleID(id string) (*entity.Account, error) {
-	db.Lock()
-	defer db.Unlock()
-
-	user := &entity.Account{}
-	err := db.gormDB.First(user, "google_id = ?", id).Error
-	return user, err
-}
-
 func (db *DB) GetUserByID(id uint) (*entity.User, error) {
 	db.Lock()
 	defer db.Unlock()
@@ -134,12 +195,17 @@ func (db *DB) GetPosts(params *PostParams) (*PostsResult, error) {
 	if params.PageSize <= 0 {
 		params.PageSize = 10
 	}
-	query := db.gormDB.Model(&entity.Post{}).Preload("LikedBy").Preload("Author").Preload("Topics").
+	query := preloadCoauthors(db.gormDB.Model(&entity.Post{}).Preload("LikedBy").Preload("Author").Preload("Topics")).
 		Order("created_at DESC")
 
 	if !params.GetHidden {
 		query = query.Where("hidden <> ?", true)
 	}
+	query = db.visibleTo(query, params.Audience)
+
+	if params.TopicName != "" {
+		query = query.Where("posts.id IN (?)", db.postIDsWithTopic(params.TopicName))
+	}
 
 	if params.SearchQuery != "" {
 		var matchingByTopic []uint64
@@ -171,6 +237,9 @@ func (db *DB) GetPosts(params *PostParams) (*PostsResult, error) {
 	if err := query.Count(&totalCount).Error; err != nil {
 		return nil, err
 	}
+	if totalCount == 0 {
+		return &PostsResult{Posts: []*entity.Post{}}, nil
+	}
 	if err := query.First(&newestPost).Error; err != nil {
 		return nil, err
 	}
@@ -208,12 +277,21 @@ func (db *DB) GetPosts(params *PostParams) (*PostsResult, error) {
 	return result, err
 }
 
+// postIDsWithTopic is a subquery for the IDs of posts tagged with topicName.
+func (db *DB) postIDsWithTopic(topicName string) *gorm.DB {
+	return db.gormDB.
+		Table("post_topics").
+		Select("post_topics.post_id").
+		Joins("JOIN topics ON post_topics.topic_id = topics.id").
+		Where("topics.name = ?", topicName)
+}
+
 func (db *DB) GetPost(postID uint) (*entity.Post, error) {
 	db.Lock()
 	defer db.Unlock()
 
 	post := &entity.Post{}
-	err := db.gormDB.Preload("LikedBy").Preload("Author").Preload("Topics").First(post, "id = ?", postID).Error
+	err := preloadCoauthors(db.gormDB.Preload("LikedBy").Preload("Author").Preload("Topics")).First(post, "id = ?", postID).Error
 	return post, err
 }
 
@@ -285,13 +363,19 @@ func (db *DB) GetPostsByOrganization(id uint, params *PostParams) (*PostsResult,
 		}
 	}
 
-	query := db.gormDB.Preload("LikedBy").Preload("Author").Preload("Topics").
+	// Include posts the organization co-authored
+	query := preloadCoauthors(db.gormDB.Model(&entity.Post{}).Preload("LikedBy").Preload("Author").Preload("Topics")).
 		Order("created_at DESC").
-		Where("author_id = ?", id)
+		Where("author_id = ? OR posts.id IN (?)", id, db.coauthoredPostIDs(id))
 
 	if !params.GetHidden {
 		query = query.Where("hidden = ?", false)
 	}
+	query = db.visibleTo(query, params.Audience)
+
+	if params.TopicName != "" {
+		query = query.Where("posts.id IN (?)", db.postIDsWithTopic(params.TopicName))
+	}
 
 	if params.SearchQuery != "" {
 		var matchingIDs []uint64
@@ -314,6 +398,9 @@ func (db *DB) GetPostsByOrganization(id uint, params *PostParams) (*PostsResult,
 	if err := query.Count(&totalCount).Error; err != nil {
 		return nil, err
 	}
+	if totalCount == 0 {
+		return &PostsResult{Posts: []*entity.Post{}}, nil
+	}
 	if err := query.First(&newestPost).Error; err != nil {
 		return nil, err
 	}
@@ -375,7 +462,13 @@ func (db *DB) AddLikeToPost(postID uint, user *entity.User) error {
 
 	post.LikedBy = append(post.LikedBy, *user)
 	post.Likes = len(post.LikedBy)
-	return db.gormDB.Preload("LikedBy").Preload("Author").Save(post).Error
+	if err := db.gormDB.Preload("LikedBy").Preload("Author").Save(post).Error; err != nil {
+		return err
+	}
+	if err := incrementPostStat(db.gormDB, post, 0, 1); err != nil {
+		log.Printf("Failed to record like on post %d: %s", post.ID, err)
+	}
+	return nil
 }
 
 func (db *DB) RemoveLikeFromPost(postID uint, user *entity.User) error {
@@ -415,6 +508,9 @@ func (db *DB) RemoveLikeFromPost(postID uint, user *entity.User) error {
 			return err
 		}
 		log.Println(post.LikedBy)
+		if err := incrementPostStat(db.gormDB, post, 0, -1); err != nil {
+			log.Printf("Failed to record unlike on post %d: %s", post.ID, err)
+		}
 		return nil
 	}
 
@@ -518,55 +614,120 @@ func (db *DB) GetOrganizations(params *OrganizationParams) (*OrganizationsResult
 	}
 
 	var organizations []*entity.User
-	query := db.gormDB.Model(&entity.User{}).
-		Where("role = ?", "organization")
+	query := db.gormDB.Model(&entity.User{}).Preload("Profile").
+		Where("users.role = ?", entity.RoleOrganization)
 
 	if params.SearchQuery != "" {
-		query = query.Where("display_name LIKE ?", fmt.Sprintf("%%%s%%", params.SearchQuery))
+		searchQuery := fmt.Sprintf("%%%s%%", params.SearchQuery)
+		matchingByProfile := db.gormDB.
+			Model(&entity.OrganizationProfile{}).
+			Select("user_id").
+			Where("description LIKE ? OR category LIKE ? OR meeting_schedule LIKE ?", searchQuery, searchQuery, searchQuery)
+		query = query.Where("(display_name LIKE ?) OR (users.id IN (?))", searchQuery, matchingByProfile)
+	}
+
+	if params.Category != "" {
+		inCategory := db.gormDB.
+			Model(&entity.OrganizationProfile{}).
+			Select("user_id").
+			Where("category = ?", params.Category)
+		query = query.Where("users.id IN (?)", inCategory)
+	}
+
+	if params.Verified != nil {
+		query = query.Where("users.verified = ?", *params.Verified)
+	}
+
+	if params.MinMembers > 0 {
+		query = query.Where("(SELECT COUNT(*) FROM organization_members WHERE organization_members.organization_id = users.id AND organization_members.status = ?) >= ?",
+			entity.MemberStatusActive, params.MinMembers)
+	}
+
+	if params.ActiveWithinDays > 0 {
+		since := time.Now().AddDate(0, 0, -params.ActiveWithinDays)
+		postedSince := db.gormDB.
+			Model(&entity.Post{}).
+			Select("author_id").
+			Where("created_at >= ?", since)
+		query = query.Where("users.id IN (?)", postedSince)
 	}
 
 	if params.PageSize <= 0 {
 		params.PageSize = 10
 	}
 
+	// Let the count and cursor lookups below each start from the filters
+	query = query.Session(&gorm.Session{})
+
 	var totalCount int64
-	var firstOrganization entity.User
-	var lastOrganization entity.User
 	if err := query.Count(&totalCount).Error; err != nil {
 		return nil, err
 	}
-	if err := query.First(&firstOrganization).Error; err != nil {
-		return nil, err
-	}
-	if err := query.Offset(int(totalCount - 1)).Limit(1).Find(&lastOrganization).Error; err != nil {
-		return nil, err
+	if totalCount == 0 {
+		return &OrganizationsResult{Organizations: []*entity.User{}}, nil
 	}
 
-	query = query.Offset(-1).Limit(-1)
+	result := &OrganizationsResult{}
+	switch params.Sort {
+	case OrganizationSortAlphabetical, OrganizationSortNewest, OrganizationSortMostActive:
+		// Sorted listings page by offset since the sort key is not the cursor
+		switch params.Sort {
+		case OrganizationSortAlphabetical:
+			query = query.Order("users.display_name COLLATE NOCASE").Order("users.id")
+		case OrganizationSortNewest:
+			query = query.Order("users.id DESC")
+		case OrganizationSortMostActive:
+			query = query.Order(clause.OrderBy{Expression: clause.Expr{
+				SQL:  "(SELECT COUNT(*) FROM posts WHERE posts.author_id = users.id AND posts.deleted_at IS NULL AND posts.created_at >= ?) DESC",
+				Vars: []any{time.Now().AddDate(0, 0, -organizationActivityDays)},
+			}}).Order("users.id")
+		}
+		if params.Page < 1 {
+			params.Page = 1
+		}
+		offset := (params.Page - 1) * params.PageSize
+		if err := query.Offset(offset).Limit(params.PageSize).Find(&organizations).Error; err != nil {
+			return nil, err
+		}
+		result.Page = params.Page
+		result.HasBefore = int64(offset+len(organizations)) < totalCount
+		result.HasAfter = params.Page > 1
+	default:
+		// Ordered by ID, with before and after as ID cursors. Newest first
+		// is the opt-in OrganizationSortNewest
+		var firstOrganization entity.User
+		var lastOrganization entity.User
+		if err := query.Order("users.id").First(&firstOrganization).Error; err != nil {
+			return nil, err
+		}
+		if err := query.Order("users.id DESC").First(&lastOrganization).Error; err != nil {
+			return nil, err
+		}
 
-	if params.Before != "" {
-		query = query.Where("id < ?", params.Before)
-	}
-	if params.After != "" {
-		query = query.Where("id > ?", params.After)
-	}
+		if params.Before != "" {
+			query = query.Where("users.id < ?", params.Before)
+		}
+		if params.After != "" {
+			query = query.Where("users.id > ?", params.After)
+		}
+		if err := query.Order("users.id").Limit(params.PageSize).Find(&organizations).Error; err != nil {
+			return nil, err
+		}
 
-	result := &OrganizationsResult{}
-	if len(organizations) > 0 {
-		result.HasBefore = organizations[len(organizations)-1].ID > lastOrganization.ID
-		result.HasAfter = organizations[0].ID < firstOrganization.ID
-	} else {
-		result.HasBefore = false
-		result.HasAfter = false
+		if len(organizations) > 0 {
+			result.HasBefore = organizations[0].ID > firstOrganization.ID
+			result.HasAfter = organizations[len(organizations)-1].ID < lastOrganization.ID
+		}
 	}
 
-	err := query.Limit(params.PageSize).
-		Find(&organizations).Error
+	if err := fillMemberCounts(db.gormDB, organizations); err != nil {
+		return nil, err
+	}
 
 	result.Organizations = organizations
 	result.Count = len(organizations)
 
-	return result, err
+	return result, nil
 }
 
 func (db *DB) GetOrganization(id uint) (*entity.User, error) {
@@ -574,6 +735,41 @@ func (db *DB) GetOrganization(id uint) (*entity.User, error) {
 	defer db.Unlock()
 
 	organization := &entity.User{}
-	err := db.gormDB.First(organization, "id = ?", id).Error
-	return organization, err
+	if err := db.gormDB.Preload("Profile").First(organization, "id = ?", id).Error; err != nil {
+		return organization, err
+	}
+	if organization.Role != entity.RoleOrganization {
+		return organization, nil
+	}
+	return organization, fillMemberCounts(db.gormDB, []*entity.User{organization})
+}
+
+// SaveOrganizationProfile creates or replaces the profile of an organization.
+func (db *DB) SaveOrganizationProfile(organizationID uint, profile *entity.OrganizationProfile) error {
+	db.Lock()
+	defer db.Unlock()
+
+	existing := &entity.OrganizationProfile{}
+	if err := db.gormDB.Where("user_id = ?", organizationID).Limit(1).Find(existing).Error; err != nil {
+		return err
+	}
+	profile.ID = existing.ID
+	profile.UserID = organizationID
+	return db.gormDB.Save(profile).Error
+}
+
+func (db *DB) SetOrganizationVerified(organization *entity.User, verified bool, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.User{}).
+			Where("id = ?", organization.ID).
+			Update("verified", verified).Error
+		if err != nil {
+			return err
+		}
+		organization.Verified = verified
+		return tx.Create(entry).Error
+	})
 }
@@ -0,0 +1,183 @@
+package sqlite
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+// ErrLastSuperAdmin is returned rather than leave nobody able to manage staff.
+var ErrLastSuperAdmin = errors.New("cannot remove the last super admin")
+
+// backfillStaffGrants keeps the accounts that hold an admin persona from
+// the ADMIN_EMAIL days admins. Only the ADMIN_EMAIL account itself becomes a
+// super admin, so existing deployments keep someone who can manage staff.
+func (db *DB) backfillStaffGrants() error {
+	var personas []struct {
+		AccountID uint
+		UserID    uint
+		Email     string
+	}
+	// An account may hold several admin personas but gets one grant
+	err := db.gormDB.Table("account_users").
+		Select("account_users.account_id, MIN(account_users.user_id) AS user_id, accounts.email").
+		Joins("JOIN users ON users.id = account_users.user_id").
+		Joins("JOIN accounts ON accounts.id = account_users.account_id").
+		Where("users.role = ?", entity.RoleAdmin).
+		Where("NOT EXISTS (SELECT 1 FROM staff_grants WHERE staff_grants.account_id = account_users.account_id)").
+		Group("account_users.account_id, accounts.email").
+		Scan(&personas).Error
+	if err != nil {
+		return err
+	}
+
+	adminEmail := strings.TrimSpace(os.Getenv("ADMIN_EMAIL"))
+	for _, p := range personas {
+		grant := &entity.StaffGrant{
+			AccountID: p.AccountID,
+			Role:      entity.StaffAdmin,
+			UserID:    p.UserID,
+		}
+		if adminEmail != "" && strings.EqualFold(p.Email, adminEmail) {
+			grant.Role = entity.StaffSuperAdmin
+		}
+		if err := db.gormDB.Create(grant).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) GetStaffGrants() ([]*entity.StaffGrant, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var grants []*entity.StaffGrant
+	err := db.gormDB.Preload("Account").Order("account_id").Find(&grants).Error
+	return grants, err
+}
+
+func (db *DB) GetStaffGrant(accountID uint) (*entity.StaffGrant, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	grant := &entity.StaffGrant{}
+	err := db.gormDB.First(grant, "account_id = ?", accountID).Error
+	return grant, err
+}
+
+// HasSuperAdmin reports whether anyone can manage staff yet.
+func (db *DB) HasSuperAdmin() (bool, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var count int64
+	err := db.gormDB.Model(&entity.StaffGrant{}).Where("role = ?", entity.StaffSuperAdmin).Count(&count).Error
+	return count > 0, err
+}
+
+// checkNotLastSuperAdmin fails when grant is the only super admin grant.
+func checkNotLastSuperAdmin(tx *gorm.DB, grant *entity.StaffGrant) error {
+	if grant.Role != entity.StaffSuperAdmin {
+		return nil
+	}
+	var count int64
+	if err := tx.Model(&entity.StaffGrant{}).Where("role = ?", entity.StaffSuperAdmin).Count(&count).Error; err != nil {
+		return err
+	}
+	if count <= 1 {
+		return ErrLastSuperAdmin
+	}
+	return nil
+}
+
+// SetStaffRole grants role to the account, adding its staff persona, or
+// changes the role of the staff persona it already has. entry may be nil.
+func (db *DB) SetStaffRole(account *entity.Account, role entity.StaffRole, grantedByAccountID *uint, entry *entity.AuditEntry) (*entity.StaffGrant, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	grant := &entity.StaffGrant{}
+	err := db.gormDB.Transaction(func(tx *gorm.DB) error {
+		err := tx.First(grant, "account_id = ?", account.ID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			persona := &entity.User{
+				DisplayName: staffDisplayName(role),
+				Role:        role.UserRole(),
+			}
+			if err := tx.Create(persona).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(account).Association("Users").Append(persona); err != nil {
+				return err
+			}
+			grant = &entity.StaffGrant{
+				AccountID:          account.ID,
+				Role:               role,
+				UserID:             persona.ID,
+				GrantedByAccountID: grantedByAccountID,
+			}
+			if err := tx.Create(grant).Error; err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else {
+			if role != entity.StaffSuperAdmin {
+				if err := checkNotLastSuperAdmin(tx, grant); err != nil {
+					return err
+				}
+			}
+			err := tx.Model(&entity.User{}).Where("id = ?", grant.UserID).Updates(map[string]any{
+				"role":         role.UserRole(),
+				"display_name": staffDisplayName(role),
+			}).Error
+			if err != nil {
+				return err
+			}
+			grant.Role = role
+			grant.GrantedByAccountID = grantedByAccountID
+			if err := tx.Save(grant).Error; err != nil {
+				return err
+			}
+		}
+
+		if entry == nil {
+			return nil
+		}
+		entry.SubjectID = account.ID
+		return tx.Create(entry).Error
+	})
+	return grant, err
+}
+
+// RemoveStaffRole takes the staff persona off the account. The persona is
+// kept so posts made through it keep their author.
+func (db *DB) RemoveStaffRole(grant *entity.StaffGrant, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := checkNotLastSuperAdmin(tx, grant); err != nil {
+			return err
+		}
+		err := tx.Exec("DELETE FROM account_users WHERE account_id = ? AND user_id = ?", grant.AccountID, grant.UserID).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(grant).Error; err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+func staffDisplayName(role entity.StaffRole) string {
+	if role == entity.StaffModerator {
+		return "Moderator"
+	}
+	return "Admin"
+}
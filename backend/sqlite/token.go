@@ -0,0 +1,51 @@
+package sqlite
+
+import (
+	"time"
+
+	"torospace.csudh.edu/api/entity"
+)
+
+// AddAccessToken stores a new token under the hash of its raw value.
+func (db *DB) AddAccessToken(token *entity.AccessToken, raw string) error {
+	db.Lock()
+	defer db.Unlock()
+
+	token.TokenHash = SessionKeyHash(raw)
+	return db.gormDB.Create(token).Error
+}
+
+// GetAccessToken looks up a token by its raw value.
+func (db *DB) GetAccessToken(raw string) (*entity.AccessToken, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	token := &entity.AccessToken{}
+	err := db.gormDB.First(token, "token_hash = ?", SessionKeyHash(raw)).Error
+	return token, err
+}
+
+func (db *DB) GetAccountAccessTokens(accountID uint) ([]*entity.AccessToken, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var tokens []*entity.AccessToken
+	err := db.gormDB.Where("account_id = ?", accountID).Order("id DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+func (db *DB) TouchAccessToken(token *entity.AccessToken, usedAt time.Time) error {
+	db.Lock()
+	defer db.Unlock()
+
+	token.LastUsedAt = &usedAt
+	return db.gormDB.Model(token).Update("last_used_at", usedAt).Error
+}
+
+func (db *DB) DeleteAccessToken(accountID uint, id uint) (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	result := db.gormDB.Where("account_id = ? AND id = ?", accountID, id).Delete(&entity.AccessToken{})
+	return result.RowsAffected, result.Error
+}
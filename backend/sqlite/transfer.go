@@ -0,0 +1,136 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+func (db *DB) GetPendingOwnershipTransfer(organizationID uint) (*entity.OwnershipTransfer, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	transfer := &entity.OwnershipTransfer{}
+	err := db.gormDB.Preload("ToAccount").
+		First(transfer, "organization_id = ? AND status = ?", organizationID, entity.TransferPending).Error
+	return transfer, err
+}
+
+func (db *DB) GetAccountOwnershipTransfers(accountID uint) ([]*entity.OwnershipTransfer, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var transfers []*entity.OwnershipTransfer
+	err := db.gormDB.
+		Where("to_account_id = ? AND status = ?", accountID, entity.TransferPending).
+		Order("id").
+		Find(&transfers).Error
+	return transfers, err
+}
+
+// AddOwnershipTransfer starts a transfer, cancelling any transfer already
+// pending for the organization so only one can be accepted.
+func (db *DB) AddOwnershipTransfer(transfer *entity.OwnershipTransfer, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.OwnershipTransfer{}).
+			Where("organization_id = ? AND status = ?", transfer.OrganizationID, entity.TransferPending).
+			Updates(map[string]any{
+				"status":      entity.TransferCancelled,
+				"resolved_at": time.Now(),
+			}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Omit("ToAccount").Create(transfer).Error; err != nil {
+			return err
+		}
+		entry.Details["transfer_id"] = fmt.Sprint(transfer.ID)
+		return tx.Create(entry).Error
+	})
+}
+
+// resolveOwnershipTransfer moves a pending transfer to status, failing if it
+// was resolved concurrently.
+func resolveOwnershipTransfer(tx *gorm.DB, transfer *entity.OwnershipTransfer, status entity.TransferStatus) error {
+	now := time.Now()
+	result := tx.Model(&entity.OwnershipTransfer{}).
+		Where("id = ? AND status = ?", transfer.ID, entity.TransferPending).
+		Updates(map[string]any{
+			"status":      status,
+			"resolved_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("ownership transfer %d is not pending", transfer.ID)
+	}
+	transfer.Status = status
+	transfer.ResolvedAt = &now
+	return nil
+}
+
+func (db *DB) CancelOwnershipTransfer(transfer *entity.OwnershipTransfer, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := resolveOwnershipTransfer(tx, transfer, entity.TransferCancelled); err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+// AcceptOwnershipTransfer makes the target account an active owner and
+// removes the previous owner's membership, moving the account_users link in
+// the same transaction. Posts and likes belong to the organization user and
+// are untouched.
+func (db *DB) AcceptOwnershipTransfer(transfer *entity.OwnershipTransfer, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := resolveOwnershipTransfer(tx, transfer, entity.TransferAccepted); err != nil {
+			return err
+		}
+
+		owner := &entity.OrganizationMember{}
+		err := tx.Where(entity.OrganizationMember{OrganizationID: transfer.OrganizationID, AccountID: transfer.ToAccountID}).
+			Attrs(entity.OrganizationMember{InvitedByAccountID: transfer.InitiatedByAccountID}).
+			FirstOrInit(owner).Error
+		if err != nil {
+			return err
+		}
+		owner.Role = entity.MemberRoleOwner
+		owner.Status = entity.MemberStatusActive
+		if err := tx.Omit("Account").Save(owner).Error; err != nil {
+			return err
+		}
+		if err := syncPersona(tx, owner, true); err != nil {
+			return err
+		}
+
+		if transfer.FromAccountID != 0 && transfer.FromAccountID != transfer.ToAccountID {
+			previous := &entity.OrganizationMember{
+				OrganizationID: transfer.OrganizationID,
+				AccountID:      transfer.FromAccountID,
+			}
+			err := tx.Where("organization_id = ? AND account_id = ?", transfer.OrganizationID, transfer.FromAccountID).
+				Delete(&entity.OrganizationMember{}).Error
+			if err != nil {
+				return err
+			}
+			if err := syncPersona(tx, previous, false); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(entry).Error
+	})
+}
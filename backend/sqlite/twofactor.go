@@ -0,0 +1,212 @@
+package sqlite
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+var (
+	// ErrCodeReused is returned for a TOTP code whose time step was already
+	// used.
+	ErrCodeReused = errors.New("code was already used")
+	// ErrTwoFactorLocked is returned while too many wrong codes in a row
+	// keep the authenticator locked.
+	ErrTwoFactorLocked = errors.New("too many wrong two-factor codes")
+)
+
+func recoveryCodeHash(code string) string {
+	return SessionKeyHash(strings.ToLower(strings.TrimSpace(code)))
+}
+
+func (db *DB) GetTwoFactor(accountID uint) (*entity.TwoFactor, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	twoFactor := &entity.TwoFactor{}
+	err := db.gormDB.First(twoFactor, "account_id = ?", accountID).Error
+	return twoFactor, err
+}
+
+// HasTwoFactor reports whether the account has an enabled authenticator.
+func (db *DB) HasTwoFactor(accountID uint) (bool, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var count int64
+	err := db.gormDB.Model(&entity.TwoFactor{}).
+		Where("account_id = ? AND enabled_at IS NOT NULL", accountID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// SetPendingTwoFactor starts enrollment, replacing any earlier pending
+// secret. An enabled authenticator is never replaced.
+func (db *DB) SetPendingTwoFactor(twoFactor *entity.TwoFactor) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("account_id = ? AND enabled_at IS NULL", twoFactor.AccountID).
+			Delete(&entity.TwoFactor{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(twoFactor).Error
+	})
+}
+
+// EnableTwoFactor confirms enrollment with the step of the first code and
+// replaces the account's recovery codes.
+func (db *DB) EnableTwoFactor(twoFactor *entity.TwoFactor, step int64, recoveryCodes []string, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(twoFactor).Where("enabled_at IS NULL").Updates(map[string]any{
+			"enabled_at": now,
+			"last_step":  step,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		twoFactor.EnabledAt = &now
+		twoFactor.LastStep = step
+
+		if err := replaceRecoveryCodes(tx, twoFactor.AccountID, recoveryCodes); err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+// CountTwoFactorAttempt counts a code about to be checked as wrong until
+// ClearTwoFactorAttempts says otherwise, so guesses sent in parallel can't
+// get past the limit. lockout says how long that many wrong codes in a row
+// lock the authenticator for. ErrTwoFactorLocked is returned while locked.
+func (db *DB) CountTwoFactorAttempt(accountID uint, now time.Time, lockout func(failures int) time.Duration) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		twoFactor := &entity.TwoFactor{}
+		if err := tx.First(twoFactor, "account_id = ?", accountID).Error; err != nil {
+			return err
+		}
+		if twoFactor.LockedUntil != nil && now.Before(*twoFactor.LockedUntil) {
+			return ErrTwoFactorLocked
+		}
+
+		failures := twoFactor.FailedAttempts + 1
+		var lockedUntil *time.Time
+		if duration := lockout(failures); duration > 0 {
+			until := now.Add(duration)
+			lockedUntil = &until
+		}
+		return tx.Model(twoFactor).Updates(map[string]any{
+			"failed_attempts": failures,
+			"locked_until":    lockedUntil,
+		}).Error
+	})
+}
+
+// ClearTwoFactorAttempts forgets the wrong codes once a right one is given.
+func (db *DB) ClearTwoFactorAttempts(accountID uint) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Model(&entity.TwoFactor{}).Where("account_id = ?", accountID).Updates(map[string]any{
+		"failed_attempts": 0,
+		"locked_until":    nil,
+	}).Error
+}
+
+// UseTwoFactorStep records a code's time step as used. A step at or before
+// the last one is refused with ErrCodeReused.
+func (db *DB) UseTwoFactorStep(twoFactor *entity.TwoFactor, step int64) error {
+	db.Lock()
+	defer db.Unlock()
+
+	result := db.gormDB.Model(twoFactor).Where("last_step < ?", step).Update("last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCodeReused
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code of the account as used.
+// It returns false when there is no such code.
+func (db *DB) UseRecoveryCode(accountID uint, code string) (bool, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	result := db.gormDB.Model(&entity.RecoveryCode{}).
+		Where("account_id = ? AND code_hash = ? AND used_at IS NULL", accountID, recoveryCodeHash(code)).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (db *DB) CountRecoveryCodes(accountID uint) (int64, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var count int64
+	err := db.gormDB.Model(&entity.RecoveryCode{}).
+		Where("account_id = ? AND used_at IS NULL", accountID).
+		Count(&count).Error
+	return count, err
+}
+
+func (db *DB) ReplaceRecoveryCodes(accountID uint, recoveryCodes []string, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := replaceRecoveryCodes(tx, accountID, recoveryCodes); err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, accountID uint, recoveryCodes []string) error {
+	if err := tx.Where("account_id = ?", accountID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	for _, code := range recoveryCodes {
+		err := tx.Create(&entity.RecoveryCode{
+			AccountID: accountID,
+			CodeHash:  recoveryCodeHash(code),
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DisableTwoFactor removes the authenticator and recovery codes.
+func (db *DB) DisableTwoFactor(accountID uint, entry *entity.AuditEntry) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("account_id = ?", accountID).Delete(&entity.TwoFactor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("account_id = ?", accountID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(entry).Error
+	})
+}
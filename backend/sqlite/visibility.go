@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"gorm.io/gorm"
+	"torospace.csudh.edu/api/entity"
+)
+
+// PostAudience describes who is reading posts. The zero value is an
+// anonymous reader, who only sees public posts.
+type PostAudience struct {
+	AccountID uint
+	Admin     bool
+}
+
+// visibleTo limits a posts query to what audience may read. Admins see
+// everything, signed-in accounts see campus posts and the members-only posts
+// of organizations they belong to.
+func (db *DB) visibleTo(query *gorm.DB, audience PostAudience) *gorm.DB {
+	if audience.Admin {
+		return query
+	}
+	if audience.AccountID == 0 {
+		return query.Where("posts.visibility = ?", entity.VisibilityPublic)
+	}
+
+	memberOf := db.gormDB.
+		Model(&entity.OrganizationMember{}).
+		Select("organization_id").
+		Where("account_id = ? AND status = ?", audience.AccountID, entity.MemberStatusActive)
+	coauthoredByMemberOf := db.gormDB.
+		Model(&entity.PostCoauthor{}).
+		Select("post_id").
+		Where("status = ? AND organization_id IN (?)", entity.CoauthorAccepted, memberOf)
+	return query.Where("posts.visibility IN ? OR (posts.visibility = ? AND (posts.author_id IN (?) OR posts.id IN (?)))",
+		[]entity.Visibility{entity.VisibilityPublic, entity.VisibilityCampus},
+		entity.VisibilityMembers, memberOf, coauthoredByMemberOf)
+}
+
+// FilterViewablePostIDs keeps the IDs of posts that exist, are not hidden
+// and that audience may read.
+func (db *DB) FilterViewablePostIDs(audience PostAudience, postIDs []uint) ([]uint, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var viewable []uint
+	if len(postIDs) == 0 {
+		return viewable, nil
+	}
+	query := db.gormDB.Model(&entity.Post{}).Where("posts.id IN ? AND posts.hidden = ?", postIDs, false)
+	err := db.visibleTo(query, audience).Pluck("posts.id", &viewable).Error
+	return viewable, err
+}
+
+// CanViewPost applies the same rules as visibleTo to a single loaded post.
+// The post's co-authors must be preloaded.
+func (db *DB) CanViewPost(audience PostAudience, post *entity.Post) bool {
+	if audience.Admin || post.IsPublic() {
+		return true
+	}
+	if audience.AccountID == 0 {
+		return false
+	}
+	if post.Visibility != entity.VisibilityMembers {
+		return true
+	}
+
+	db.Lock()
+	defer db.Unlock()
+
+	organizationIDs := []uint{post.AuthorID}
+	for _, coauthor := range post.Coauthors {
+		if coauthor.Status == entity.CoauthorAccepted {
+			organizationIDs = append(organizationIDs, coauthor.OrganizationID)
+		}
+	}
+	var count int64
+	err := db.gormDB.Model(&entity.OrganizationMember{}).
+		Where("account_id = ? AND status = ? AND organization_id IN ?", audience.AccountID, entity.MemberStatusActive, organizationIDs).
+		Count(&count).Error
+	return err == nil && count > 0
+}
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"time"
+
+	"torospace.csudh.edu/api/entity"
+)
+
+type WebhookDeliveryParams struct {
+	Before   string `json:"before"`
+	PageSize int    `json:"page_size"`
+}
+
+type WebhookDeliveriesResult struct {
+	Deliveries []*entity.WebhookDelivery `json:"deliveries"`
+	Count      int                       `json:"count"`
+	HasBefore  bool                      `json:"has_before"`
+}
+
+func (db *DB) CreateWebhook(webhook *entity.Webhook) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Create(webhook).Error
+}
+
+func (db *DB) GetWebhooks(organizationID uint) ([]*entity.Webhook, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var webhooks []*entity.Webhook
+	err := db.gormDB.Where("organization_id = ?", organizationID).Order("id").Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (db *DB) GetWebhook(organizationID uint, webhookID uint) (*entity.Webhook, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	webhook := &entity.Webhook{}
+	err := db.gormDB.First(webhook, "id = ? AND organization_id = ?", webhookID, organizationID).Error
+	return webhook, err
+}
+
+func (db *DB) DeleteWebhook(webhook *entity.Webhook) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Delete(webhook).Error
+}
+
+// EnqueueWebhookDeliveries stores a pending delivery of payload for every
+// active webhook of the organization subscribed to eventType.
+func (db *DB) EnqueueWebhookDeliveries(organizationID uint, eventType string, payload []byte) error {
+	db.Lock()
+	defer db.Unlock()
+
+	var webhooks []*entity.Webhook
+	if err := db.gormDB.Where("organization_id = ? AND active = ?", organizationID, true).Find(&webhooks).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, webhook := range webhooks {
+		if !webhook.Subscribed(eventType) {
+			continue
+		}
+		delivery := &entity.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        entity.WebhookDeliveryPending,
+			NextAttemptAt: now,
+		}
+		if err := db.gormDB.Create(delivery).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (db *DB) GetDueWebhookDeliveries(now time.Time, limit int) ([]*entity.WebhookDelivery, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	var deliveries []*entity.WebhookDelivery
+	err := db.gormDB.Preload("Webhook").
+		Where("status = ? AND next_attempt_at <= ?", entity.WebhookDeliveryPending, now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&deliveries).Error
+	return deliveries, err
+}
+
+func (db *DB) SaveWebhookDelivery(delivery *entity.WebhookDelivery) error {
+	db.Lock()
+	defer db.Unlock()
+
+	return db.gormDB.Omit("Webhook").Save(delivery).Error
+}
+
+func (db *DB) GetWebhookDelivery(webhookID uint, deliveryID uint) (*entity.WebhookDelivery, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	delivery := &entity.WebhookDelivery{}
+	err := db.gormDB.First(delivery, "id = ? AND webhook_id = ?", deliveryID, webhookID).Error
+	return delivery, err
+}
+
+func (db *DB) GetWebhookDeliveries(webhookID uint, params *WebhookDeliveryParams) (*WebhookDeliveriesResult, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	if params == nil {
+		params = &WebhookDeliveryParams{
+			PageSize: 20,
+		}
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = 20
+	}
+
+	query := db.gormDB.Model(&entity.WebhookDelivery{}).
+		Where("webhook_id = ?", webhookID).
+		Order("id DESC")
+	if params.Before != "" {
+		query = query.Where("id < ?", params.Before)
+	}
+
+	var deliveries []*entity.WebhookDelivery
+	// Fetch one extra row to know whether there is an older page
+	if err := query.Limit(params.PageSize + 1).Find(&deliveries).Error; err != nil {
+		return nil, err
+	}
+
+	result := &WebhookDeliveriesResult{}
+	if len(deliveries) > params.PageSize {
+		deliveries = deliveries[:params.PageSize]
+		result.HasBefore = true
+	}
+	result.Deliveries = deliveries
+	result.Count = len(deliveries)
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, base32 encoded
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// The RFC gives 8 digits, the last 6 are the codes apps show
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		code, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %s", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("Code at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	for offset := int64(-2); offset <= 2; offset++ {
+		code, err := Code(rfcSecret, current+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		step, ok := Validate(rfcSecret, code, now)
+		if want := offset >= -skew && offset <= skew; ok != want {
+			t.Errorf("Validate with step offset %d = %t, want %t", offset, ok, want)
+		} else if ok && step != current+offset {
+			t.Errorf("Validate with step offset %d matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+
+	if _, ok := Validate(rfcSecret, " 050471 ", now); !ok {
+		t.Error("Validate refused a code with surrounding spaces")
+	}
+	if _, ok := Validate(rfcSecret, "50471", now); ok {
+		t.Error("Validate accepted a short code")
+	}
+	if _, ok := Validate("not base32!", "050471", now); ok {
+		t.Error("Validate accepted a code for a bad secret")
+	}
+}
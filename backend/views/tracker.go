@@ -0,0 +1,112 @@
+package views
+
+import (
+	"sync"
+	"time"
+)
+
+type viewKey struct {
+	viewer string
+	postID uint
+}
+
+// budget is how many views a source had counted since start.
+type budget struct {
+	start time.Time
+	count int
+}
+
+// Tracker counts post views in memory. A viewer is counted at most once per
+// post within the window, a source (such as a client address) at most
+// maxPerSource times per window, and counts accumulate until Take hands them
+// to a batch writer. At most maxSeen viewer and post pairs are remembered;
+// views beyond that are not counted until old ones expire.
+type Tracker struct {
+	window       time.Duration
+	maxSeen      int
+	maxPerSource int
+	seen         map[viewKey]time.Time
+	sources      map[string]*budget
+	pending      map[uint]int64
+	sync.Mutex
+}
+
+func NewTracker(window time.Duration, maxSeen int, maxPerSource int) *Tracker {
+	return &Tracker{
+		window:       window,
+		maxSeen:      maxSeen,
+		maxPerSource: maxPerSource,
+		seen:         map[viewKey]time.Time{},
+		sources:      map[string]*budget{},
+		pending:      map[uint]int64{},
+	}
+}
+
+// Record counts a view of postID by viewer from source unless the viewer
+// was already counted within the window or the source used up its budget,
+// and reports whether it was counted.
+func (t *Tracker) Record(viewer string, source string, postID uint, now time.Time) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	key := viewKey{viewer: viewer, postID: postID}
+	if last, ok := t.seen[key]; ok && now.Sub(last) < t.window {
+		return false
+	}
+	sourceBudget, ok := t.sources[source]
+	if ok && now.Sub(sourceBudget.start) < t.window && sourceBudget.count >= t.maxPerSource {
+		return false
+	}
+	if _, ok := t.seen[key]; !ok && len(t.seen) >= t.maxSeen {
+		t.forget(now)
+		if len(t.seen) >= t.maxSeen {
+			return false
+		}
+	}
+
+	if !ok || now.Sub(sourceBudget.start) >= t.window {
+		sourceBudget = &budget{start: now}
+		t.sources[source] = sourceBudget
+	}
+	sourceBudget.count++
+	t.seen[key] = now
+	t.pending[postID]++
+	return true
+}
+
+// forget drops viewers and sources whose window has passed.
+func (t *Tracker) forget(now time.Time) {
+	for key, last := range t.seen {
+		if now.Sub(last) >= t.window {
+			delete(t.seen, key)
+		}
+	}
+	for source, sourceBudget := range t.sources {
+		if now.Sub(sourceBudget.start) >= t.window {
+			delete(t.sources, source)
+		}
+	}
+}
+
+// Take returns the views counted since the last call and resets them. It
+// also forgets viewers whose window has passed, to bound memory.
+func (t *Tracker) Take(now time.Time) map[uint]int64 {
+	t.Lock()
+	defer t.Unlock()
+
+	t.forget(now)
+	pending := t.pending
+	t.pending = map[uint]int64{}
+	return pending
+}
+
+// Restore puts back counts that could not be written, so they are retried
+// with the next batch.
+func (t *Tracker) Restore(counts map[uint]int64) {
+	t.Lock()
+	defer t.Unlock()
+
+	for postID, count := range counts {
+		t.pending[postID] += count
+	}
+}
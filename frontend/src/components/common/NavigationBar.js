@@ -20,9 +20,17 @@ const navItems = [
 
 export default function NavigationBar() {
     const {user, loggedIn} = useContext(UserContext);
+    const [providers, setProviders] = React.useState(['google']);
 
-    const handleSignIn = () => {
-        window.location.href = 'http://localhost:3030/auth/google';
+    React.useEffect(() => {
+        fetch('http://localhost:3030/auth/providers')
+            .then(response => response.json())
+            .then(data => setProviders(data['providers']))
+            .catch(error => console.error('Failed to fetch login providers:', error));
+    }, []);
+
+    const handleSignIn = (provider) => {
+        window.location.href = `http://localhost:3030/auth/${provider}`;
     };
 
     const handleSignOut = () => {
@@ -47,14 +55,16 @@ export default function NavigationBar() {
                     user?.role === 'admin' && <li className='hover:underline hover:cursor-pointer text-white text-lg font-bold transition duration-300 ease-in-out'><Link to='/admin'>Admin</Link></li>
                 }
                 {
-                    (!loggedIn) &&
-                    <button
-                        className='bg-[#E6BC46] text-white text-lg font-bold py-2 px-4 rounded-full 
-                            hover:bg-[#C69C26] hover:text-gray transition duration-300 ease-in-out'
-                        onClick={handleSignIn}
-                    >
-                        Sign In
-                    </button>
+                    (!loggedIn) && providers.map(provider =>
+                        <button
+                            key={provider}
+                            className='bg-[#E6BC46] text-white text-lg font-bold py-2 px-4 rounded-full 
+                                hover:bg-[#C69C26] hover:text-gray transition duration-300 ease-in-out'
+                            onClick={() => handleSignIn(provider)}
+                        >
+                            {providers.length > 1 ? `Sign In (${provider})` : 'Sign In'}
+                        </button>
+                    )
                 }
                 {
                     (loggedIn) &&
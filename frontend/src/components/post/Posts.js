@@ -12,7 +12,7 @@ export default function Posts(props) {
 }
 
 // export function Post({postID, displayName, avatar, content, date, topics, likes, isLiked}) {
-export function Post({postData: {id, author: {display_name, avatar_url, id: authorID}, content, created_at, topics, likes, liked_by, hidden}, showLink, startRefresh}) {
+export function Post({postData: {id, author: {display_name, avatar_url, id: authorID}, content, created_at, topics, likes, views, liked_by, hidden}, showLink, startRefresh}) {
     const {user} = React.useContext(UserContext);
     const [upvoteSelected, setUpvoteSelected] = React.useState(liked_by?.map(u => u.id).some(id => id === user.id));
     const [likesCount, setLikesCount] = React.useState(likes);
@@ -124,6 +124,7 @@ export function Post({postData: {id, author: {display_name, avatar_url, id: auth
                         <p className='button'>👍</p>
                     </button>
                     <p>{likesCount ?? 0}</p>
+                    <p title='views'>👁️ {views ?? 0}</p>
                     {/* <p>💬</p> */}
                     {!isHidden && (user.role === 'admin' || (user.role === 'organization' && user.id === authorID)) && <button className='button hover:bg-blue-100' onClick={() => handleHide('hide')}>🙈</button>}
                     {isHidden && (user.role === 'admin' || (user.role === 'organization' && user.id === authorID)) && <button className='button hover:bg-blue-100' onClick={() => handleHide('unhide')}>🙉</button>}
@@ -29,6 +29,17 @@ export default function PostsView() {
                 setPosts(data['posts']);
                 setHasNextPage(data['has_before']);
                 setHasPrevPage(data['has_after']);
+                // Count the page of posts now on screen as viewed
+                if (data['posts']?.length > 0) {
+                    fetch('http://localhost:3030/posts/views', {
+                        method: 'POST',
+                        credentials: 'include',
+                        headers: {
+                            'Content-Type': 'application/json'
+                        },
+                        body: JSON.stringify({ post_ids: data['posts'].map(post => post.id) })
+                    }).catch(error => console.error('Failed to report views:', error));
+                }
             } catch (error) {
                 setPosts([]);
                 setHasNextPage(false);
@@ -38,7 +49,18 @@ export default function PostsView() {
         }
         fetchData();
     }, [latestPost, searchQuery, endpoint, refreshNeeded]);
+
+    // Refetch the current page whenever the server pushes a post update
+    React.useEffect(() => {
+        const stream = new EventSource('http://localhost:3030/stream', { withCredentials: true });
+        const refresh = () => startRefresh(Date.now());
+        ['post.created', 'post.liked', 'post.hidden', 'post.unhidden', 'post.deleted', 'post.updated', 'resync']
+            .forEach(type => stream.addEventListener(type, refresh));
+        return () => stream.close();
+    }, []);
+
     const [newPostContent, setNewPostContent] = React.useState('');
+    const [newPostVisibility, setNewPostVisibility] = React.useState('public');
 
     const handlePostClick = async () => {
         if (newPostContent == null || newPostContent.length === 0) {
@@ -54,7 +76,7 @@ export default function PostsView() {
                 'Content-Type': 'application/json'
             },
             // Remove the hashtags from the content and send them as topics
-            body: JSON.stringify({ content: nonHashtagMessage, topics: hashtags.map(tag => tag.substring(1))})
+            body: JSON.stringify({ content: nonHashtagMessage, topics: hashtags.map(tag => tag.substring(1)), visibility: newPostVisibility })
         });
 
         if (response.status !== 200) {
@@ -99,6 +121,15 @@ export default function PostsView() {
                         value={newPostContent}
                         onChange={(e) => setNewPostContent(e.target.value)}
                     ></textarea>
+                    <select
+                        className="ml-2 p-2 border border-gray-300 rounded-md"
+                        value={newPostVisibility}
+                        onChange={(e) => setNewPostVisibility(e.target.value)}
+                    >
+                        <option value="public">Public</option>
+                        <option value="campus">Campus only</option>
+                        <option value="members">Members only</option>
+                    </select>
                     <button
                         className="ml-2 px-4 py-2 bg-blue-500
                             hover:bg-[#1b62d6] text-white rounded-md transition-colors duration-300"